@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+
+	"cache-web-server/internal/repository/postgres"
+	"cache-web-server/internal/transport/auth"
+)
+
+// bootstrapAdmin создает первого администратора.
+// Пароль берется из флага -password или переменной окружения ADMIN_PASSWORD.
+func bootstrapAdmin(db *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("bootstrap-admin", flag.ContinueOnError)
+	login := fs.String("login", "", "логин администратора")
+	password := fs.String("password", os.Getenv("ADMIN_PASSWORD"), "пароль администратора")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *login == "" || *password == "" {
+		return fmt.Errorf("использование: bootstrap-admin -login <логин> [-password <пароль>]")
+	}
+
+	if err := auth.BootstrapAdmin(context.Background(), postgres.NewUsers(db), db, *login, *password); err != nil {
+		return err
+	}
+
+	fmt.Printf("Администратор %s создан\n", *login)
+	return nil
+}
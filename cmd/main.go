@@ -1,9 +1,19 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"cache-web-server/internal/db"
+	"cache-web-server/config"
+	dbpkg "cache-web-server/internal/db"
+	"cache-web-server/internal/jobs"
+	"cache-web-server/internal/logging"
+	"cache-web-server/internal/tracing"
 	"cache-web-server/internal/transport"
 
 	"github.com/joho/godotenv"
@@ -15,15 +25,101 @@ func main() {
 		log.Fatalf("Ошибка загрузки .env: %v", err)
 	}
 
+	// Логи в формате JSON, стандартный log тоже пишет через slog
+	logging.Setup(os.Stdout, config.LogLevel())
+
+	// Трассировка останавливается последней, чтобы отправить спаны остановки
+	tracingCtx, stopTracing := context.WithCancel(context.Background())
+	defer stopTracing()
+	tracingDone := startTracing(tracingCtx)
+
 	// Подключаемся к базе данных
-	db, err := db.InitDb()
+	db, err := dbpkg.InitDb()
 	if err != nil {
-		log.Fatalf("Ошибка подключения к БД: %v", err)
+		fatal("ошибка подключения к БД", err)
 	}
 	defer db.Close()
 
+	// Миграции схемы управляются вручную
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(db, os.Args[2:]); err != nil {
+			db.Close()
+			fatal("ошибка миграции", err)
+		}
+		return
+	}
+
+	// Миграции под блокировкой, поэтому одновременный запуск нескольких экземпляров безопасен
+	if config.DBAutoMigrate() {
+		if _, err := dbpkg.MigrateUp(context.Background(), db); err != nil {
+			db.Close()
+			fatal("ошибка миграции", err)
+		}
+	}
+
+	// Служебные команды
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "bootstrap-admin":
+			if err := bootstrapAdmin(db, os.Args[2:]); err != nil {
+				fatal("ошибка создания администратора", err)
+			}
+			return
+		default:
+			fatal("неизвестная команда", fmt.Errorf("%s", os.Args[1]))
+		}
+	}
+
+	// Останавливаемся по SIGINT и SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Фоновые задачи останавливаются после завершения запросов
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	// Запускаем фоновую очистку корзины
+	trashDone := jobs.StartTrashPurger(jobsCtx, db, config.TrashRetention(), config.TrashPurgeInterval())
+
+	// Запускаем фоновое удаление документов с истекшим сроком хранения
+	expiryDone := jobs.StartExpiryReaper(jobsCtx, db, config.ExpiryInterval(), config.ExpiryBatchSize())
+
 	// Получаем порт и запускаем сервер
 	port := transport.GetPort()
-	transport.StartServer(port, db)
+	serverErr := transport.StartServer(ctx, port, db)
+
+	// Сервер остановлен, останавливаем фоновые задачи до закрытия БД
+	stopJobs()
+	<-trashDone
+	<-expiryDone
+	stopTracing()
+	<-tracingDone
+
+	if serverErr != nil {
+		db.Close()
+		fatal("ошибка сервера", serverErr)
+	}
+	slog.Info("сервер остановлен")
+}
+
+// startTracing включает экспорт трасс, если задан адрес коллектора
+func startTracing(ctx context.Context) <-chan struct{} {
+	cfg := config.Tracing()
+	if cfg.Endpoint == "" {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+
+	exporter := tracing.NewOTLPExporter(cfg.Endpoint, cfg.ServiceName, cfg.Headers, cfg.ExportTimeout)
+	provider := tracing.NewProvider(exporter, cfg.SampleRatio)
+	tracing.SetProvider(provider)
+	slog.Info("трассировка включена", "endpoint", cfg.Endpoint, "sample_ratio", cfg.SampleRatio)
+	return provider.Start(ctx, cfg.ExportDelay)
+}
 
+// fatal логирует ошибку и завершает процесс
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	dbpkg "cache-web-server/internal/db"
+)
+
+// migrate управляет миграциями схемы БД: migrate up, migrate down [-steps N], migrate status
+func migrate(db *sql.DB, args []string) error {
+	usage := fmt.Errorf("использование: migrate up | down [-steps N] | status")
+	if len(args) == 0 {
+		return usage
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := dbpkg.MigrateUp(ctx, db)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Применено миграций: %d\n", len(applied))
+		return nil
+
+	case "down":
+		fs := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := fs.Int("steps", 1, "сколько последних миграций откатить")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *steps < 1 {
+			return usage
+		}
+		reverted, err := dbpkg.MigrateDown(ctx, db, *steps)
+		if err != nil {
+			return err
+		}
+		for _, m := range reverted {
+			fmt.Printf("Откачена миграция %04d_%s\n", m.Version, m.Name)
+		}
+		return nil
+
+	case "status":
+		states, err := dbpkg.MigrationStatus(ctx, db)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ВЕРСИЯ\tИМЯ\tПРИМЕНЕНА")
+		for _, s := range states {
+			applied := "нет"
+			if !s.Applied.IsZero() {
+				applied = s.Applied.Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+	}
+
+	return usage
+}
@@ -1,6 +1,11 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // DBConfig содержит настройки для подключения к базе данных.
 type DBConfig struct {
@@ -11,8 +16,292 @@ type DBConfig struct {
 	DBName   string
 }
 
-// AdminToken получается админ токен их переменной окружения
-func AdminToken() string {
-	token := os.Getenv("ADMIN_TOKEN")
-	return token
+// PasswordPolicy требования к паролю пользователя
+type PasswordPolicy struct {
+	MinLength      int
+	RequireUpper   bool
+	RequireLower   bool
+	RequireDigit   bool
+	RequireSpecial bool
+}
+
+// Password возвращает политику паролей, по умолчанию минимум 8 символов
+// с заглавной и строчной буквой, цифрой и спецсимволом
+func Password() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:      envInt("PASSWORD_MIN_LENGTH", 8),
+		RequireUpper:   envBool("PASSWORD_REQUIRE_UPPER", true),
+		RequireLower:   envBool("PASSWORD_REQUIRE_LOWER", true),
+		RequireDigit:   envBool("PASSWORD_REQUIRE_DIGIT", true),
+		RequireSpecial: envBool("PASSWORD_REQUIRE_SPECIAL", true),
+	}
+}
+
+// TLSConfig настройки встроенного HTTPS
+type TLSConfig struct {
+	CertFile       string
+	KeyFile        string
+	ClientCAFile   string
+	ClientAuth     string
+	MinVersion     string
+	CipherSuites   []string
+	ReloadInterval time.Duration
+}
+
+// TLS возвращает настройки HTTPS. Если TLS_CERT_FILE пуст, сервер работает по HTTP.
+// TLS_CLIENT_AUTH: none, request или require, по умолчанию none.
+func TLS() TLSConfig {
+	return TLSConfig{
+		CertFile:       os.Getenv("TLS_CERT_FILE"),
+		KeyFile:        os.Getenv("TLS_KEY_FILE"),
+		ClientCAFile:   os.Getenv("TLS_CLIENT_CA_FILE"),
+		ClientAuth:     os.Getenv("TLS_CLIENT_AUTH"),
+		MinVersion:     os.Getenv("TLS_MIN_VERSION"),
+		CipherSuites:   strings.FieldsFunc(os.Getenv("TLS_CIPHER_SUITES"), func(r rune) bool { return r == ',' || r == ' ' }),
+		ReloadInterval: envDuration("TLS_RELOAD_INTERVAL", time.Minute),
+	}
+}
+
+// ShutdownDelay сколько сервер продолжает принимать запросы после снятия готовности,
+// чтобы балансировщик успел исключить его, по умолчанию 5 секунд
+func ShutdownDelay() time.Duration {
+	return envDuration("SHUTDOWN_DELAY", 5*time.Second)
+}
+
+// ShutdownTimeout сколько ждать завершения текущих запросов при остановке, по умолчанию 30 секунд
+func ShutdownTimeout() time.Duration {
+	return envDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+}
+
+// HealthCheckTimeout ограничение времени каждой проверки готовности, по умолчанию 2 секунды
+func HealthCheckTimeout() time.Duration {
+	return envDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second)
+}
+
+// MetricsToken токен доступа к /metrics, если пусто — метрики доступны без авторизации
+func MetricsToken() string {
+	return os.Getenv("METRICS_TOKEN")
+}
+
+// DBAutoMigrate применять ли миграции схемы при запуске сервера, по умолчанию да.
+// При отключении миграции применяются командой migrate up.
+func DBAutoMigrate() bool {
+	return envBool("DB_AUTO_MIGRATE", true)
+}
+
+// TracingConfig настройки трассировки
+type TracingConfig struct {
+	Endpoint      string
+	Headers       map[string]string
+	ServiceName   string
+	SampleRatio   float64
+	ExportTimeout time.Duration
+	ExportDelay   time.Duration
+}
+
+// Tracing возвращает настройки экспорта трасс по OTLP/HTTP. Имена переменных
+// совпадают со стандартными переменными OpenTelemetry, таймауты в миллисекундах.
+// Если OTEL_EXPORTER_OTLP_ENDPOINT пуст, трассировка отключена.
+// OTEL_EXPORTER_OTLP_HEADERS: пары key=value через запятую.
+func Tracing() TracingConfig {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if key, value, ok := strings.Cut(pair, "="); ok && strings.TrimSpace(key) != "" {
+			headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = "cache-web-server"
+	}
+
+	ratio, err := strconv.ParseFloat(os.Getenv("OTEL_TRACES_SAMPLER_ARG"), 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		ratio = 1
+	}
+
+	return TracingConfig{
+		Endpoint:      os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		Headers:       headers,
+		ServiceName:   service,
+		SampleRatio:   ratio,
+		ExportTimeout: time.Duration(envInt("OTEL_EXPORTER_OTLP_TIMEOUT", 10000)) * time.Millisecond,
+		ExportDelay:   time.Duration(envInt("OTEL_BSP_SCHEDULE_DELAY", 5000)) * time.Millisecond,
+	}
+}
+
+// LogLevel уровень логирования: debug, info, warn или error, по умолчанию info
+func LogLevel() string {
+	return os.Getenv("LOG_LEVEL")
+}
+
+// ResetTokenTTL время жизни одноразового токена сброса пароля, по умолчанию 24 часа
+func ResetTokenTTL() time.Duration {
+	return envDuration("RESET_TOKEN_TTL", 24*time.Hour)
+}
+
+// LoginMaxAttempts неудачных попыток входа на логин до блокировки, по умолчанию 5
+func LoginMaxAttempts() int {
+	return max(envInt("LOGIN_MAX_ATTEMPTS", 5), 1)
+}
+
+// LoginMaxAttemptsIP неудачных попыток входа с одного IP до блокировки, по умолчанию 20
+func LoginMaxAttemptsIP() int {
+	return max(envInt("LOGIN_MAX_ATTEMPTS_IP", 20), 1)
+}
+
+// LoginAttemptWindow через сколько после последней неудачи счетчик попыток сбрасывается, по умолчанию 15 минут
+func LoginAttemptWindow() time.Duration {
+	return envDuration("LOGIN_ATTEMPT_WINDOW", 15*time.Minute)
+}
+
+// LoginLockoutBase длительность первой блокировки входа, по умолчанию 1 минута
+func LoginLockoutBase() time.Duration {
+	return envDuration("LOGIN_LOCKOUT_BASE", time.Minute)
+}
+
+// LoginLockoutMax максимальная длительность блокировки входа, по умолчанию 1 час
+func LoginLockoutMax() time.Duration {
+	return envDuration("LOGIN_LOCKOUT_MAX", time.Hour)
+}
+
+// OIDC возвращает настройки входа через OpenID Connect.
+// Если OIDC_ISSUER не задан, вход через IdP отключен.
+func OIDC() (issuer, clientID, clientSecret, redirectURL string, scopes []string) {
+	scopes = strings.Fields(os.Getenv("OIDC_SCOPES"))
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	return os.Getenv("OIDC_ISSUER"), os.Getenv("OIDC_CLIENT_ID"), os.Getenv("OIDC_CLIENT_SECRET"),
+		os.Getenv("OIDC_REDIRECT_URL"), scopes
+}
+
+// OIDCAutoProvision создавать ли учетные записи для новых пользователей IdP
+func OIDCAutoProvision() bool {
+	return envBool("OIDC_AUTO_PROVISION", false)
+}
+
+// ShareLinkSecret ключ подписи ссылок на документы. Обязателен и не должен совпадать
+// с JWT_SECRET: один ключ не используется и для токенов, и для ссылок.
+func ShareLinkSecret() string {
+	return os.Getenv("SHARE_LINK_SECRET")
+}
+
+// ShareLinkMaxTTL максимальный срок действия ссылки на документ, по умолчанию 30 дней
+func ShareLinkMaxTTL() time.Duration {
+	return envDuration("SHARE_LINK_MAX_TTL", 30*24*time.Hour)
+}
+
+// PublicBaseURL внешний адрес сервера для формирования ссылок, например https://cache.example.com
+func PublicBaseURL() string {
+	return strings.TrimSuffix(os.Getenv("PUBLIC_BASE_URL"), "/")
+}
+
+// VersionRetention сколько версий документа хранить (0 — без ограничения), по умолчанию 10
+func VersionRetention() int {
+	return envInt("VERSION_RETENTION", 10)
+}
+
+// envInt читает целое число из переменной окружения или возвращает значение по умолчанию
+func envInt(key string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value < 0 {
+		return def
+	}
+	return value
+}
+
+// TrashRetention сколько хранить документы в корзине, по умолчанию 30 дней
+func TrashRetention() time.Duration {
+	return envDuration("TRASH_RETENTION", 30*24*time.Hour)
+}
+
+// TrashPurgeInterval как часто очищать корзину, по умолчанию раз в час
+func TrashPurgeInterval() time.Duration {
+	return envDuration("TRASH_PURGE_INTERVAL", time.Hour)
+}
+
+// ExpiryInterval как часто удалять документы с истекшим сроком хранения, по умолчанию раз в минуту
+func ExpiryInterval() time.Duration {
+	return envDuration("EXPIRY_INTERVAL", time.Minute)
+}
+
+// ExpiryBatchSize сколько документов с истекшим сроком удалять за один запрос, по умолчанию 100
+func ExpiryBatchSize() int {
+	return max(envInt("EXPIRY_BATCH_SIZE", 100), 1)
+}
+
+// SessionCacheTTL сколько кэшировать проверку сессии в памяти, по умолчанию 10 секунд
+func SessionCacheTTL() time.Duration {
+	return envDuration("SESSION_CACHE_TTL", 10*time.Second)
+}
+
+// JWTIssuer значение iss в выпускаемых токенах
+func JWTIssuer() string {
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "cache-web-server"
+}
+
+// AccessTokenTTL время жизни access-токена, по умолчанию 15 минут
+func AccessTokenTTL() time.Duration {
+	return envDuration("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+// RefreshTokenTTL время жизни refresh-токена, по умолчанию 30 дней
+func RefreshTokenTTL() time.Duration {
+	return envDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+// JWTKeysDir каталог с ключами подписи токенов. Если не задан, используется JWT_SECRET (HS256).
+func JWTKeysDir() string {
+	return os.Getenv("JWT_KEYS_DIR")
+}
+
+// JWTKeyAlg алгоритм новых ключей подписи: RS256 (по умолчанию) или EdDSA
+func JWTKeyAlg() string {
+	if alg := os.Getenv("JWT_KEY_ALG"); alg != "" {
+		return alg
+	}
+	return "RS256"
+}
+
+// JWTKeyRotation как часто генерировать новый ключ подписи (0 — не генерировать)
+func JWTKeyRotation() time.Duration {
+	value, err := time.ParseDuration(os.Getenv("JWT_KEY_ROTATION"))
+	if err != nil || value < 0 {
+		return 0
+	}
+	return value
+}
+
+// JWTKeyOverlap сколько принимать токены предыдущего ключа после ротации, по умолчанию 1 час.
+// Должно быть не меньше ACCESS_TOKEN_TTL, иначе после ротации отклонялись бы еще действующие токены.
+func JWTKeyOverlap() time.Duration {
+	return envDuration("JWT_KEY_OVERLAP", time.Hour)
+}
+
+// JWTKeysReload как часто перечитывать каталог ключей, по умолчанию раз в минуту
+func JWTKeysReload() time.Duration {
+	return envDuration("JWT_KEYS_RELOAD", time.Minute)
+}
+
+// envBool читает логическое значение из переменной окружения или возвращает значение по умолчанию
+func envBool(key string, def bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// envDuration читает длительность из переменной окружения или возвращает значение по умолчанию
+func envDuration(key string, def time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return def
+	}
+	return value
 }
@@ -0,0 +1,157 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Области действия ключей
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// keyPrefix префикс ключей, чтобы их было легко узнать в логах и конфигурации CI
+const keyPrefix = "cws_"
+
+var (
+	// ErrNotFound ключ не найден или принадлежит другому пользователю
+	ErrNotFound = errors.New("ключ не найден")
+	// ErrInvalid ключ не существует, отозван или истек
+	ErrInvalid = errors.New("недействительный ключ")
+)
+
+// APIKey модель персонального API-ключа
+type APIKey struct {
+	ID       int      `json:"id"`
+	Name     string   `json:"name"`
+	Prefix   string   `json:"prefix"`
+	Scopes   []string `json:"scopes"`
+	Created  string   `json:"created"`
+	Expires  string   `json:"expires,omitempty"`
+	LastUsed string   `json:"last_used,omitempty"`
+	Key      string   `json:"key,omitempty"`
+}
+
+// Store хранилище API-ключей. В БД хранится только хэш ключа.
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore создает хранилище API-ключей
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// ValidScopes проверяет, что все области действия известны
+func ValidScopes(scopes []string) bool {
+	for _, scope := range scopes {
+		if scope != ScopeRead && scope != ScopeWrite {
+			return false
+		}
+	}
+	return true
+}
+
+// hashKey возвращает хэш ключа для хранения в БД
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create выпускает новый ключ пользователя. Сам ключ возвращается только здесь.
+func (s *Store) Create(ctx context.Context, login, name string, scopes []string, expires *time.Time) (*APIKey, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("ошибка при генерации ключа: %w", err)
+	}
+	key := keyPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	apiKey := &APIKey{Name: name, Prefix: key[:len(keyPrefix)+6], Scopes: scopes, Key: key}
+	query := `INSERT INTO api_keys (login, name, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created`
+	err := s.db.QueryRowContext(ctx, query, login, name, apiKey.Prefix, hashKey(key), scopes, expires).
+		Scan(&apiKey.ID, &apiKey.Created)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при сохранении ключа: %w", err)
+	}
+	if expires != nil {
+		apiKey.Expires = expires.UTC().Format(time.RFC3339)
+	}
+
+	return apiKey, nil
+}
+
+// List возвращает неотозванные ключи пользователя
+func (s *Store) List(ctx context.Context, login string) ([]APIKey, error) {
+	query := `SELECT id, name, prefix, array_to_string(scopes, ','), created,
+			COALESCE((expires_at AT TIME ZONE 'UTC')::text, ''), COALESCE(last_used::text, '')
+		FROM api_keys WHERE login = $1 AND revoked_at IS NULL ORDER BY created`
+	rows, err := s.db.QueryContext(ctx, query, login)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при чтении ключей: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		var scopes string
+		if err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &scopes, &key.Created, &key.Expires, &key.LastUsed); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении ключей: %w", err)
+		}
+		key.Scopes = strings.Split(scopes, ",")
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// Revoke отзывает ключ пользователя
+func (s *Store) Revoke(ctx context.Context, login string, id int) error {
+	query := `UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND login = $2 AND revoked_at IS NULL`
+	res, err := s.db.ExecContext(ctx, query, id, login)
+	if err != nil {
+		return fmt.Errorf("ошибка при отзыве ключа: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Authenticate проверяет ключ и возвращает логин владельца и области действия.
+// Время последнего использования обновляется не чаще раза в минуту.
+func (s *Store) Authenticate(ctx context.Context, key string) (string, []string, error) {
+	if !strings.HasPrefix(key, keyPrefix) {
+		return "", nil, ErrInvalid
+	}
+
+	var id int
+	var login, scopes string
+	query := `SELECT id, login, array_to_string(scopes, ',') FROM api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())`
+	err := s.db.QueryRowContext(ctx, query, hashKey(key)).Scan(&id, &login, &scopes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, ErrInvalid
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("ошибка при проверке ключа: %w", err)
+	}
+
+	query = `UPDATE api_keys SET last_used = NOW()
+		WHERE id = $1 AND (last_used IS NULL OR last_used < NOW() - INTERVAL '1 minute')`
+	if _, err := s.db.ExecContext(ctx, query, id); err != nil {
+		return "", nil, fmt.Errorf("ошибка при обновлении ключа: %w", err)
+	}
+
+	return login, strings.Split(scopes, ","), nil
+}
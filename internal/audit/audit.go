@@ -0,0 +1,188 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cache-web-server/internal/logging"
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/utils"
+)
+
+// Действия, которые записываются в журнал аудита
+const (
+	ActionRegister       = "user.register"
+	ActionLogin          = "auth.login"
+	ActionLoginFailed    = "auth.login_failed"
+	ActionLogout         = "auth.logout"
+	ActionUpload         = "doc.upload"
+	ActionDownload       = "doc.download"
+	ActionDelete         = "doc.delete"
+	ActionPurge          = "doc.purge"
+	ActionRestore        = "doc.restore"
+	ActionVersionRestore = "doc.version_restore"
+	ActionPermissions    = "doc.permissions"
+	ActionShareCreate    = "share.create"
+	ActionShareRevoke    = "share.revoke"
+	ActionShareDownload  = "share.download"
+	ActionGroupCreate    = "group.create"
+	ActionGroupMembers   = "group.members"
+	ActionGroupDelete    = "group.delete"
+
+	ActionUserDisable       = "user.disable"
+	ActionUserEnable        = "user.enable"
+	ActionUserForceReset    = "user.force_reset"
+	ActionUserUnlock        = "user.unlock"
+	ActionResetTokenIssue   = "user.reset_token"
+	ActionPasswordChange    = "user.password_change"
+	ActionPasswordReset     = "user.password_reset"
+	ActionAPIKeyCreate      = "user.apikey_create"
+	ActionAPIKeyRevoke      = "user.apikey_revoke"
+	ActionUserEmail         = "user.email"
+	ActionUserDelete        = "user.delete"
+	ActionCertificateAdd    = "user.certificate_add"
+	ActionCertificateRemove = "user.certificate_remove"
+)
+
+// Execer общий интерфейс для *sql.DB и *sql.Tx, через который пишется журнал
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Record добавляет событие в журнал аудита. IP, User-Agent и идентификатор
+// запроса берутся из r, если он передан. Запись не отменяется вместе с запросом:
+// событие должно попасть в журнал, даже если клиент уже отключился.
+// Ошибка записи только логируется, чтобы сбой журнала не прерывал обработку запроса.
+func Record(db Execer, r *http.Request, actor, action, target string, details map[string]interface{}) {
+	ctx := context.Background()
+	var ip, userAgent, requestID string
+	if r != nil {
+		ctx = context.WithoutCancel(r.Context())
+		ip = utils.ClientIP(r)
+		userAgent = r.UserAgent()
+		requestID = logging.RequestID(ctx)
+	}
+
+	var payload interface{}
+	if len(details) > 0 {
+		data, err := json.Marshal(details)
+		if err != nil {
+			slog.ErrorContext(ctx, "ошибка при записи в журнал аудита", "action", action, "error", err)
+			return
+		}
+		payload = string(data)
+	}
+
+	query := `INSERT INTO audit_log (actor, action, target, ip, user_agent, request_id, details)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	if _, err := db.ExecContext(ctx, query, actor, action, target, ip, userAgent, requestID, payload); err != nil {
+		slog.ErrorContext(ctx, "ошибка при записи в журнал аудита", "action", action, "error", err)
+	}
+}
+
+// Filter условия выборки из журнала аудита, пустые поля не учитываются
+type Filter struct {
+	Actor  string
+	Action string
+	Target string
+	From   time.Time
+	To     time.Time
+	// AfterID возвращает события с id больше заданного, для постраничного чтения
+	AfterID int64
+	// Limit максимальное число событий, 0 — без ограничения
+	Limit int
+}
+
+// where формирует условие запроса по фильтру
+func (f Filter) where() (string, []interface{}) {
+	conds := []string{}
+	args := []interface{}{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.Actor != "" {
+		add("actor = $%d", f.Actor)
+	}
+	if f.Action != "" {
+		// Действие можно задать префиксом, например doc. или auth.
+		// starts_with не трактует % и _ в фильтре как шаблон, в отличие от LIKE.
+		if strings.HasSuffix(f.Action, ".") {
+			add("starts_with(action, $%d)", f.Action)
+		} else {
+			add("action = $%d", f.Action)
+		}
+	}
+	if f.Target != "" {
+		add("target = $%d", f.Target)
+	}
+	if !f.From.IsZero() {
+		add("created >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("created < $%d", f.To)
+	}
+	if f.AfterID > 0 {
+		add("id > $%d", f.AfterID)
+	}
+
+	query := ""
+	if len(conds) > 0 {
+		query = " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY id"
+	if f.Limit > 0 {
+		args = append(args, f.Limit)
+		query += " LIMIT $" + strconv.Itoa(len(args))
+	}
+	return query, args
+}
+
+// Each вызывает fn для каждого события, подходящего под фильтр, в порядке записи
+func Each(ctx context.Context, db *sql.DB, f Filter, fn func(models.AuditEvent) error) error {
+	where, args := f.where()
+	query := `SELECT id, created, actor, action, target, ip, user_agent, request_id, COALESCE(details::text, '')
+		FROM audit_log` + where
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("ошибка при чтении журнала аудита: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.AuditEvent
+		var created time.Time
+		var details string
+		if err := rows.Scan(&e.ID, &created, &e.Actor, &e.Action, &e.Target, &e.IP, &e.UserAgent, &e.RequestID, &details); err != nil {
+			return fmt.Errorf("ошибка при чтении журнала аудита: %w", err)
+		}
+		e.Time = created.UTC().Format(time.RFC3339Nano)
+		if details != "" {
+			if err := json.Unmarshal([]byte(details), &e.Details); err != nil {
+				return fmt.Errorf("ошибка при чтении журнала аудита: %w", err)
+			}
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// List возвращает события, подходящие под фильтр
+func List(ctx context.Context, db *sql.DB, f Filter) ([]models.AuditEvent, error) {
+	events := []models.AuditEvent{}
+	err := Each(ctx, db, f, func(e models.AuditEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	return events, err
+}
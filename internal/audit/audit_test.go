@@ -0,0 +1,30 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cache-web-server/internal/audit/audittest"
+)
+
+func TestRecordOutlivesRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodDelete, "/api/docs/1", nil).WithContext(ctx)
+	r.Header.Set("User-Agent", "test")
+	// Клиент отключился до записи в журнал
+	cancel()
+
+	var log audittest.Recorder
+	Record(&log, r, "alice", ActionDelete, "1", map[string]interface{}{"trash": true})
+
+	entries := log.Entries()
+	if len(entries) != 1 || entries[0].Ctx.Err() != nil {
+		t.Fatal("запись в журнал отменена вместе с запросом")
+	}
+	e := entries[0]
+	if e.Actor != "alice" || e.Action != ActionDelete || e.UserAgent != "test" || e.Details != `{"trash":true}` {
+		t.Fatalf("неожиданная запись: %+v", e)
+	}
+}
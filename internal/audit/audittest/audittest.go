@@ -0,0 +1,59 @@
+// Package audittest содержит журнал аудита в памяти для тестов обработчиков
+package audittest
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// Entry запись журнала аудита
+type Entry struct {
+	// Ctx контекст, с которым выполнялась запись
+	Ctx       context.Context
+	Actor     string
+	Action    string
+	Target    string
+	IP        string
+	UserAgent string
+	RequestID string
+	// Details детали события в JSON, nil если их нет
+	Details interface{}
+}
+
+// Recorder реализует audit.Execer и запоминает записи вместо INSERT в audit_log
+type Recorder struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// ExecContext разбирает аргументы INSERT из audit.Record
+func (r *Recorder) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	entry := Entry{Ctx: ctx, Details: args[6]}
+	for i, field := range []*string{&entry.Actor, &entry.Action, &entry.Target, &entry.IP, &entry.UserAgent, &entry.RequestID} {
+		*field, _ = args[i].(string)
+	}
+
+	r.mu.Lock()
+	r.entries = append(r.entries, entry)
+	r.mu.Unlock()
+	return nil, nil
+}
+
+// Entries возвращает записи в порядке добавления
+func (r *Recorder) Entries() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Entry(nil), r.entries...)
+}
+
+// Actions возвращает действия записей в порядке добавления
+func (r *Recorder) Actions() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	actions := make([]string, 0, len(r.entries))
+	for _, entry := range r.entries {
+		actions = append(actions, entry.Action)
+	}
+	return actions
+}
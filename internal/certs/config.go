@@ -0,0 +1,93 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// Режимы проверки клиентских сертификатов
+const (
+	ClientAuthNone    = "none"
+	ClientAuthRequest = "request"
+	ClientAuthRequire = "require"
+)
+
+// Options настройки TLS сервера
+type Options struct {
+	// ClientCAFile PEM-файл с корневыми сертификатами для проверки клиентов.
+	// Читается один раз при запуске, без перезапуска перечитываются только сертификат и ключ сервера.
+	ClientCAFile string
+	// ClientAuth режим проверки клиентских сертификатов: none, request или require
+	ClientAuth string
+	// MinVersion минимальная версия протокола: 1.2 или 1.3
+	MinVersion string
+	// CipherSuites имена разрешенных наборов шифров TLS 1.2, пусто — набор Go по умолчанию.
+	// Для HTTP/2 список должен включать TLS_ECDHE_*_WITH_AES_128_GCM_SHA256.
+	CipherSuites []string
+}
+
+// versions поддерживаемые минимальные версии TLS
+var versions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ServerConfig собирает tls.Config сервера с сертификатом из reloader и поддержкой HTTP/2
+func ServerConfig(reloader *Reloader, opts Options) (*tls.Config, error) {
+	cfg := &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+		MinVersion:     tls.VersionTLS12,
+	}
+
+	if opts.MinVersion != "" {
+		version, ok := versions[opts.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("неподдерживаемая версия TLS %q", opts.MinVersion)
+		}
+		cfg.MinVersion = version
+	}
+
+	if len(opts.CipherSuites) > 0 {
+		// Допускаются только безопасные наборы шифров
+		known := map[string]uint16{}
+		for _, suite := range tls.CipherSuites() {
+			known[suite.Name] = suite.ID
+		}
+		for _, name := range opts.CipherSuites {
+			id, ok := known[name]
+			if !ok {
+				return nil, fmt.Errorf("неизвестный или небезопасный набор шифров %q", name)
+			}
+			cfg.CipherSuites = append(cfg.CipherSuites, id)
+		}
+	}
+
+	switch opts.ClientAuth {
+	case "", ClientAuthNone:
+		return cfg, nil
+	case ClientAuthRequest:
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("неизвестный режим проверки клиентов %q", opts.ClientAuth)
+	}
+
+	if opts.ClientCAFile == "" {
+		return nil, fmt.Errorf("для проверки клиентских сертификатов нужен файл корневых сертификатов")
+	}
+	pem, err := os.ReadFile(opts.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения корневых сертификатов: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("в файле %s нет корневых сертификатов", opts.ClientCAFile)
+	}
+	cfg.ClientCAs = pool
+
+	return cfg, nil
+}
@@ -2,15 +2,17 @@ package db
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"os"
 
 	"cache-web-server/config"
+	"cache-web-server/internal/tracing"
 
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5/stdlib"
 )
 
-// InitDb создает соединение с базой данных.
+// InitDb создает соединение с базой данных. Схема создается миграциями, см. MigrateUp.
 func InitDb() (*sql.DB, error) {
 	// Конфиг базы данных
 	cfg := config.DBConfig{
@@ -23,10 +25,12 @@ func InitDb() (*sql.DB, error) {
 
 	// Формируем строку подключения к БД
 	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
-	db, err := sql.Open("pgx", dsn)
+	connector, err := stdlib.GetDefaultDriver().(driver.DriverContext).OpenConnector(dsn)
 	if err != nil {
 		return nil, fmt.Errorf("не удалось открыть соединение: %w", err)
 	}
+	// Запросы в рамках запросов к серверу попадают в трассу
+	db := sql.OpenDB(tracing.WrapConnector(connector))
 
 	// Проверяем, что соединение рабочее
 	if err := db.Ping(); err != nil {
@@ -34,43 +38,5 @@ func InitDb() (*sql.DB, error) {
 		return nil, fmt.Errorf("не удалось подключиться к базе данных: %w", err)
 	}
 
-	// Создаем таблицы
-	if err := CreateTables(db); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("ошибка при создании таблиц: %w", err)
-	}
-
 	return db, nil
 }
-
-// CreateTables создаёт необходимые таблицы в базе данных.
-func CreateTables(db *sql.DB) error {
-	// Запросы на создание таблиц
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS users (
-			id SERIAL PRIMARY KEY,
-			login VARCHAR(255) UNIQUE NOT NULL,
-			password VARCHAR(100) NOT NULL,
-    		token TEXT
-		);`,
-		`CREATE TABLE IF NOT EXISTS documents (
-			id VARCHAR(255) PRIMARY KEY,
-			name VARCHAR(255) NOT NULL,
-			mime VARCHAR(50),
-    		has_file BOOLEAN,
-			public BOOLEAN DEFAULT FALSE,
-			grant_login TEXT[],
-    		owner VARCHAR(255),
-			created TIMESTAMP DEFAULT NOW(),
-			file BYTEA
-		);`,
-	}
-
-	for _, query := range queries {
-		if _, err := db.Exec(query); err != nil {
-			return fmt.Errorf("ошибка при создании таблицы: %w", err)
-		}
-	}
-
-	return nil
-}
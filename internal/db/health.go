@@ -0,0 +1,42 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// CheckSchema проверяет, что к БД применены все миграции, встроенные в сервер
+func CheckSchema(ctx context.Context, db *sql.DB) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return fmt.Errorf("ошибка при проверке схемы: %w", err)
+	}
+
+	var pending []string
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok {
+			pending = append(pending, fmt.Sprintf("%04d_%s", m.Version, m.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("не применены миграции: %s", strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// CheckStorage проверяет, что хранилище содержимого документов доступно на чтение.
+// Содержимое документов хранится в таблице documents.
+func CheckStorage(ctx context.Context, db *sql.DB) error {
+	var n int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM (SELECT 1 FROM documents LIMIT 1) d`).Scan(&n)
+	if err != nil {
+		return fmt.Errorf("хранилище документов недоступно: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// migrationFiles SQL-скрипты миграций: NNNN_имя.up.sql и необязательный NNNN_имя.down.sql
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationName формат имени файла миграции
+var migrationName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// migrationLock ключ advisory-блокировки, под которой применяются миграции,
+// чтобы одновременно запущенные экземпляры сервера не применяли их параллельно
+const migrationLock = 7343201049
+
+// Migration миграция схемы БД
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState миграция и время ее применения, нулевое если она не применена
+type MigrationState struct {
+	Migration
+	Applied time.Time
+}
+
+// Migrations возвращает встроенные миграции по возрастанию версий
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("неверное имя файла миграции: %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		script, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("у миграции %d разные имена: %s и %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(script)
+		} else {
+			m.Down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("у миграции %d нет скрипта up", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// withMigrationLock выполняет fn на отдельном соединении под advisory-блокировкой.
+// Блокировка сессионная, поэтому все запросы миграций идут через одно соединение.
+func withMigrationLock(ctx context.Context, db *sql.DB, fn func(conn *sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("не удалось получить соединение: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLock); err != nil {
+		return fmt.Errorf("не удалось получить блокировку миграций: %w", err)
+	}
+	defer func() {
+		// Снимаем блокировку и при отмене ctx, иначе она останется до закрытия соединения
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLock); err != nil {
+			slog.Warn("не удалось снять блокировку миграций", "error", err)
+		}
+	}()
+
+	query := `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+	)`
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("ошибка при создании таблицы миграций: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// queryer общий интерфейс для *sql.DB и *sql.Conn
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// appliedMigrations возвращает время применения миграций по версиям
+func appliedMigrations(ctx context.Context, db queryer) (map[int]time.Time, error) {
+	rows, err := db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при чтении примененных миграций: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении примененных миграций: %w", err)
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// runMigration выполняет скрипт и изменяет schema_migrations в одной транзакции
+func runMigration(ctx context.Context, conn *sql.Conn, script, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MigrateUp применяет все непримененные миграции по возрастанию версий.
+// Каждая миграция выполняется в своей транзакции. Возвращает примененные миграции.
+func MigrateUp(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	err = withMigrationLock(ctx, db, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			record := `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`
+			if err := runMigration(ctx, conn, m.Up, record, m.Version, m.Name); err != nil {
+				return fmt.Errorf("ошибка при применении миграции %04d_%s: %w", m.Version, m.Name, err)
+			}
+			slog.Info("миграция применена", "version", m.Version, "name", m.Name)
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// MigrateDown откатывает steps последних примененных миграций.
+// Возвращает откаченные миграции.
+func MigrateDown(ctx context.Context, db *sql.DB, steps int) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	err = withMigrationLock(ctx, db, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("миграция %04d_%s не поддерживает откат", m.Version, m.Name)
+			}
+			record := `DELETE FROM schema_migrations WHERE version = $1`
+			if err := runMigration(ctx, conn, m.Down, record, m.Version); err != nil {
+				return fmt.Errorf("ошибка при откате миграции %04d_%s: %w", m.Version, m.Name, err)
+			}
+			slog.Info("миграция откачена", "version", m.Version, "name", m.Name)
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// MigrationStatus возвращает все встроенные миграции с временем применения
+func MigrationStatus(ctx context.Context, db *sql.DB) ([]MigrationState, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var states []MigrationState
+	err = withMigrationLock(ctx, db, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			states = append(states, MigrationState{Migration: m, Applied: applied[m.Version]})
+		}
+		return nil
+	})
+	return states, err
+}
@@ -0,0 +1,63 @@
+-- Пользователи и документы с правами доступа, версиями, корзиной и сроком хранения.
+-- Запросы идемпотентны, чтобы миграция применялась и к базам, созданным до появления миграций.
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	login VARCHAR(255) UNIQUE NOT NULL,
+	password VARCHAR(100) NOT NULL,
+	token TEXT
+);
+
+CREATE TABLE IF NOT EXISTS documents (
+	id VARCHAR(255) PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	mime VARCHAR(50),
+	has_file BOOLEAN,
+	public BOOLEAN DEFAULT FALSE,
+	owner VARCHAR(255),
+	created TIMESTAMP DEFAULT NOW(),
+	file BYTEA
+);
+
+CREATE TABLE IF NOT EXISTS document_grants (
+	doc_id VARCHAR(255) NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	login VARCHAR(255) NOT NULL,
+	permission VARCHAR(10) NOT NULL DEFAULT 'read'
+		CHECK (permission IN ('read', 'write', 'manage')),
+	PRIMARY KEY (doc_id, login)
+);
+
+-- Переносим старые grant_login в document_grants с правом на чтение
+DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM information_schema.columns
+		WHERE table_name = 'documents' AND column_name = 'grant_login') THEN
+		INSERT INTO document_grants (doc_id, login, permission)
+			SELECT id, unnest(grant_login), 'read' FROM documents WHERE grant_login IS NOT NULL
+			ON CONFLICT DO NOTHING;
+		ALTER TABLE documents DROP COLUMN grant_login;
+	END IF;
+END $$;
+
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS updated TIMESTAMP DEFAULT NOW();
+
+CREATE TABLE IF NOT EXISTS document_versions (
+	doc_id VARCHAR(255) NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	version INTEGER NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	mime VARCHAR(50),
+	has_file BOOLEAN,
+	public BOOLEAN,
+	access JSONB NOT NULL DEFAULT '{}',
+	file BYTEA,
+	author VARCHAR(255),
+	created TIMESTAMP DEFAULT NOW(),
+	PRIMARY KEY (doc_id, version)
+);
+
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(255);
+CREATE INDEX IF NOT EXISTS documents_deleted_at_idx ON documents (deleted_at) WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS documents_expires_at_idx ON documents (expires_at) WHERE expires_at IS NOT NULL;
@@ -0,0 +1,22 @@
+-- Сессии и одноразовые refresh-токены
+CREATE TABLE IF NOT EXISTS sessions (
+	id VARCHAR(64) PRIMARY KEY,
+	login VARCHAR(255) NOT NULL REFERENCES users(login) ON DELETE CASCADE,
+	ip VARCHAR(64),
+	user_agent TEXT,
+	created TIMESTAMP DEFAULT NOW(),
+	last_seen TIMESTAMP DEFAULT NOW(),
+	revoked_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS sessions_login_idx ON sessions (login);
+
+-- Раньше токен хранился в самой сессии
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	id SERIAL PRIMARY KEY,
+	session_id VARCHAR(64) NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+	token_hash VARCHAR(64) UNIQUE NOT NULL,
+	created TIMESTAMP DEFAULT NOW(),
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP
+);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS login_attempts;
+DROP TABLE IF EXISTS password_resets;
+ALTER TABLE users DROP COLUMN IF EXISTS created;
+ALTER TABLE users DROP COLUMN IF EXISTS must_reset_password;
+ALTER TABLE users DROP COLUMN IF EXISTS disabled;
+ALTER TABLE users DROP COLUMN IF EXISTS role;
+DROP TABLE IF EXISTS api_keys;
@@ -0,0 +1,36 @@
+-- API-ключи, роли, отключение учетных записей, сброс паролей и блокировка подбора
+CREATE TABLE IF NOT EXISTS api_keys (
+	id SERIAL PRIMARY KEY,
+	login VARCHAR(255) NOT NULL REFERENCES users(login) ON DELETE CASCADE,
+	name VARCHAR(255) NOT NULL,
+	prefix VARCHAR(16) NOT NULL,
+	key_hash VARCHAR(64) UNIQUE NOT NULL,
+	scopes TEXT[] NOT NULL,
+	created TIMESTAMP DEFAULT NOW(),
+	expires_at TIMESTAMP,
+	last_used TIMESTAMP,
+	revoked_at TIMESTAMP
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user'
+	CHECK (role IN ('admin', 'user', 'readonly'));
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS must_reset_password BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created TIMESTAMP DEFAULT NOW();
+
+CREATE TABLE IF NOT EXISTS password_resets (
+	id SERIAL PRIMARY KEY,
+	login VARCHAR(255) NOT NULL REFERENCES users(login) ON DELETE CASCADE,
+	token_hash VARCHAR(64) UNIQUE NOT NULL,
+	issued_by VARCHAR(255),
+	created TIMESTAMP DEFAULT NOW(),
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+	key VARCHAR(300) PRIMARY KEY,
+	failures INTEGER NOT NULL DEFAULT 0,
+	last_failure TIMESTAMP NOT NULL DEFAULT NOW(),
+	locked_until TIMESTAMP
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS oidc_states;
+DROP TABLE IF EXISTS user_identities;
+DROP INDEX IF EXISTS users_email_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS email;
@@ -0,0 +1,18 @@
+-- Вход через OpenID Connect
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email VARCHAR(255);
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_idx ON users (lower(email)) WHERE email IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS user_identities (
+	issuer VARCHAR(255) NOT NULL,
+	subject VARCHAR(255) NOT NULL,
+	login VARCHAR(255) NOT NULL REFERENCES users(login) ON DELETE CASCADE,
+	created TIMESTAMP DEFAULT NOW(),
+	PRIMARY KEY (issuer, subject)
+);
+
+CREATE TABLE IF NOT EXISTS oidc_states (
+	state VARCHAR(64) PRIMARY KEY,
+	nonce VARCHAR(64) NOT NULL,
+	verifier VARCHAR(128) NOT NULL,
+	expires_at TIMESTAMP NOT NULL
+);
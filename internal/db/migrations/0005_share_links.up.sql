@@ -0,0 +1,13 @@
+-- Ссылки для скачивания документов без входа
+CREATE TABLE IF NOT EXISTS share_links (
+	id VARCHAR(64) PRIMARY KEY,
+	doc_id VARCHAR(255) NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	created_by VARCHAR(255) NOT NULL,
+	created TIMESTAMP DEFAULT NOW(),
+	expires_at TIMESTAMP NOT NULL,
+	max_downloads INTEGER,
+	downloads INTEGER NOT NULL DEFAULT 0,
+	password_hash VARCHAR(100),
+	revoked_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS share_links_doc_id_idx ON share_links (doc_id);
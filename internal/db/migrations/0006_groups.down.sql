@@ -0,0 +1,3 @@
+DELETE FROM document_grants WHERE login LIKE 'group:%';
+DROP TABLE IF EXISTS group_members;
+DROP TABLE IF EXISTS groups;
@@ -0,0 +1,13 @@
+-- Группы пользователей, которым выдаются права на документы
+CREATE TABLE IF NOT EXISTS groups (
+	name VARCHAR(64) PRIMARY KEY,
+	owner VARCHAR(255) REFERENCES users(login) ON DELETE SET NULL,
+	created TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+	group_name VARCHAR(64) NOT NULL REFERENCES groups(name) ON DELETE CASCADE,
+	login VARCHAR(255) NOT NULL REFERENCES users(login) ON DELETE CASCADE,
+	PRIMARY KEY (group_name, login)
+);
+CREATE INDEX IF NOT EXISTS group_members_login_idx ON group_members (login);
@@ -0,0 +1,7 @@
+-- Вход по клиентским сертификатам TLS
+CREATE TABLE IF NOT EXISTS client_certificates (
+	subject VARCHAR(1024) PRIMARY KEY,
+	login VARCHAR(255) NOT NULL REFERENCES users(login) ON DELETE CASCADE,
+	created TIMESTAMP DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS client_certificates_login_idx ON client_certificates (login);
@@ -0,0 +1,2 @@
+-- Восстановленные версии не отличить от обычных, поэтому откат их не удаляет
+SELECT 1;
@@ -0,0 +1,9 @@
+-- Документы, созданные до появления истории версий, получают версию с текущим состоянием,
+-- иначе их исходное содержимое теряется после первого изменения
+INSERT INTO document_versions (doc_id, version, name, mime, has_file, public, access, file, author, created)
+	SELECT d.id, d.version, d.name, d.mime, d.has_file, d.public,
+		COALESCE((SELECT jsonb_object_agg(g.login, g.permission) FROM document_grants g WHERE g.doc_id = d.id), '{}'),
+		d.file, d.owner, COALESCE(d.updated, d.created)
+	FROM documents d
+	WHERE NOT EXISTS (SELECT 1 FROM document_versions v WHERE v.doc_id = d.id)
+	ON CONFLICT (doc_id, version) DO NOTHING;
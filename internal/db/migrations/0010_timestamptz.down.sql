@@ -0,0 +1,4 @@
+ALTER TABLE documents ALTER COLUMN expires_at TYPE TIMESTAMP;
+ALTER TABLE api_keys ALTER COLUMN expires_at TYPE TIMESTAMP;
+ALTER TABLE share_links ALTER COLUMN expires_at TYPE TIMESTAMP;
+ALTER TABLE audit_log ALTER COLUMN created TYPE TIMESTAMP;
@@ -0,0 +1,8 @@
+-- Время, которое приложение записывает или сравнивает со своими значениями, хранится
+-- с часовым поясом: TIMESTAMP без пояса терял смещение времени приложения
+-- и сравнивался с NOW() в поясе сессии БД.
+-- Прежние значения считаются записанными в поясе сессии БД.
+ALTER TABLE documents ALTER COLUMN expires_at TYPE TIMESTAMPTZ;
+ALTER TABLE api_keys ALTER COLUMN expires_at TYPE TIMESTAMPTZ;
+ALTER TABLE share_links ALTER COLUMN expires_at TYPE TIMESTAMPTZ;
+ALTER TABLE audit_log ALTER COLUMN created TYPE TIMESTAMPTZ;
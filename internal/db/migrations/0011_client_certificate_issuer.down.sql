@@ -0,0 +1,6 @@
+-- Из привязок одного субъекта к разным издателям остается одна
+DELETE FROM client_certificates c USING client_certificates d
+	WHERE c.subject = d.subject AND c.issuer > d.issuer;
+ALTER TABLE client_certificates DROP CONSTRAINT IF EXISTS client_certificates_pkey;
+ALTER TABLE client_certificates DROP COLUMN IF EXISTS issuer;
+ALTER TABLE client_certificates ADD PRIMARY KEY (subject);
@@ -0,0 +1,6 @@
+-- Клиентский сертификат сопоставляется по издателю и субъекту: сертификат с тем же
+-- субъектом от другого доверенного CA не должен входить под тем же пользователем.
+-- Прежние привязки без издателя перестают действовать, пока их не добавят заново.
+ALTER TABLE client_certificates ADD COLUMN IF NOT EXISTS issuer VARCHAR(1024) NOT NULL DEFAULT '';
+ALTER TABLE client_certificates DROP CONSTRAINT IF EXISTS client_certificates_pkey;
+ALTER TABLE client_certificates ADD PRIMARY KEY (issuer, subject);
@@ -0,0 +1,132 @@
+package health
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/utils"
+)
+
+// Статусы проверки
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// CheckFunc проверяет доступность зависимости
+type CheckFunc func(ctx context.Context) error
+
+// Result результат проверки одной зависимости.
+// Ошибка не отдается клиенту: /readyz доступен без авторизации,
+// а в тексте ошибки бывают адреса, ответы драйвера и имена миграций.
+type Result struct {
+	Status   string `json:"status"`
+	Error    error  `json:"-"`
+	Duration int64  `json:"duration_ms"`
+}
+
+// check именованная проверка
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker проверки готовности сервера к приему запросов
+type Checker struct {
+	timeout time.Duration
+	checks  []check
+	ready   atomic.Bool
+}
+
+// New создает Checker, каждая проверка ограничена timeout
+func New(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add добавляет проверку зависимости
+func (c *Checker) Add(name string, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// SetReady включает или снимает готовность независимо от проверок,
+// например перед остановкой сервера
+func (c *Checker) SetReady(ready bool) {
+	c.ready.Store(ready)
+}
+
+// Run выполняет все проверки параллельно
+func (c *Checker) Run(ctx context.Context) map[string]Result {
+	results := make(map[string]Result, len(c.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, ch := range c.checks {
+		wg.Add(1)
+		go func(ch check) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := ch.fn(checkCtx)
+			result := Result{Status: StatusOK, Duration: time.Since(start).Milliseconds()}
+			if err != nil {
+				result.Status = StatusFail
+				result.Error = err
+			}
+
+			mu.Lock()
+			results[ch.name] = result
+			mu.Unlock()
+		}(ch)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// LiveHandler отвечает 200, пока процесс жив и обрабатывает запросы
+func (c *Checker) LiveHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		utils.WriteJSONResponse(w, http.StatusOK, models.APIResponse{
+			Response: map[string]interface{}{"status": StatusOK},
+		})
+	}
+}
+
+// ReadyHandler отвечает 200, если сервер готов и все проверки прошли, иначе 503
+// со статусом и длительностью каждой проверки. Ошибки проверок только логируются.
+func (c *Checker) ReadyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := StatusOK
+		code := http.StatusOK
+
+		results := c.Run(r.Context())
+		for name, result := range results {
+			if result.Status != StatusOK {
+				status = StatusFail
+				slog.WarnContext(r.Context(), "проверка готовности не прошла", "check", name, "error", result.Error)
+			}
+		}
+		if !c.ready.Load() {
+			status = StatusFail
+		}
+		if status != StatusOK {
+			code = http.StatusServiceUnavailable
+		}
+
+		utils.WriteJSONResponse(w, code, models.APIResponse{
+			Response: map[string]interface{}{
+				"status": status,
+				"ready":  c.ready.Load(),
+				"checks": results,
+			},
+		})
+	}
+}
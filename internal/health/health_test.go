@@ -0,0 +1,33 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadyHandlerHidesCheckErrors(t *testing.T) {
+	checker := New(time.Second)
+	checker.Add("database", func(ctx context.Context) error {
+		return errors.New("dial tcp 10.0.0.5:5432: connection refused")
+	})
+	checker.SetReady(true)
+
+	w := httptest.NewRecorder()
+	checker.ReadyHandler()(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("статус %d, ожидался 503", w.Code)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "10.0.0.5") || strings.Contains(body, "error") {
+		t.Fatalf("ошибка проверки попала в ответ: %s", body)
+	}
+	if !strings.Contains(body, `"database":{"status":"fail"`) {
+		t.Fatalf("в ответе нет статуса проверки: %s", body)
+	}
+}
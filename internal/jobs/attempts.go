@@ -0,0 +1,35 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"cache-web-server/internal/loginguard"
+)
+
+// StartAttemptsCleanup запускает фоновую очистку устаревших счетчиков попыток входа.
+// Воркер останавливается при отмене ctx.
+// Возвращает канал, который закрывается после остановки.
+func StartAttemptsCleanup(ctx context.Context, guard *loginguard.Guard, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if _, err := guard.Cleanup(ctx); err != nil && ctx.Err() == nil {
+				slog.Error("ошибка при очистке попыток входа", "error", err)
+			}
+		}
+	}()
+	return done
+}
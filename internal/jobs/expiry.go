@@ -0,0 +1,63 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+// StartExpiryReaper запускает фоновое удаление документов с истекшим сроком хранения.
+// Документы удаляются пачками по batchSize раз в interval.
+// Воркер останавливается при отмене ctx.
+// Возвращает канал, который закрывается после остановки.
+func StartExpiryReaper(ctx context.Context, db *sql.DB, interval time.Duration, batchSize int) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			reapExpired(ctx, db, batchSize)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return done
+}
+
+// reapExpired удаляет документы с истекшим сроком хранения, пока они не закончатся
+func reapExpired(ctx context.Context, db *sql.DB, batchSize int) {
+	query := `DELETE FROM documents WHERE id IN (
+			SELECT id FROM documents WHERE expires_at <= NOW() LIMIT $1 FOR UPDATE SKIP LOCKED)`
+
+	var total int64
+	for ctx.Err() == nil {
+		res, err := db.ExecContext(ctx, query, batchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("ошибка при удалении документов с истекшим сроком", "error", err)
+			}
+			break
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			break
+		}
+		total += n
+		if n < int64(batchSize) {
+			break
+		}
+	}
+
+	if total > 0 {
+		slog.Info("удалены документы с истекшим сроком", "count", total)
+	}
+}
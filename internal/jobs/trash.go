@@ -0,0 +1,49 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+// StartTrashPurger запускает фоновую очистку корзины.
+// Документы, пролежавшие в корзине дольше retention, удаляются раз в interval.
+// Воркер останавливается при отмене ctx.
+// Возвращает канал, который закрывается после остановки.
+func StartTrashPurger(ctx context.Context, db *sql.DB, retention, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			purgeTrash(ctx, db, retention)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return done
+}
+
+// purgeTrash удаляет документы из корзины старше retention
+func purgeTrash(ctx context.Context, db *sql.DB, retention time.Duration) {
+	query := `DELETE FROM documents WHERE deleted_at IS NOT NULL AND deleted_at < NOW() - make_interval(secs => $1)`
+	res, err := db.ExecContext(ctx, query, retention.Seconds())
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("ошибка при очистке корзины", "error", err)
+		}
+		return
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		slog.Info("из корзины удалены документы", "count", n)
+	}
+}
@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"cache-web-server/internal/tracing"
+)
+
+// requestInfo данные запроса, которые добавляются ко всем записям лога.
+// Логин становится известен после авторизации, поэтому хранится по указателю.
+type requestInfo struct {
+	id string
+
+	mu    sync.RWMutex
+	login string
+}
+
+// infoKey ключ requestInfo в контексте
+type infoKey struct{}
+
+// WithRequestID возвращает контекст с идентификатором запроса
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, infoKey{}, &requestInfo{id: id})
+}
+
+// RequestID возвращает идентификатор запроса из контекста
+func RequestID(ctx context.Context) string {
+	if info, ok := ctx.Value(infoKey{}).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// SetLogin запоминает логин пользователя запроса для записей лога
+func SetLogin(ctx context.Context, login string) {
+	if info, ok := ctx.Value(infoKey{}).(*requestInfo); ok {
+		info.mu.Lock()
+		info.login = login
+		info.mu.Unlock()
+	}
+}
+
+// Login возвращает логин пользователя запроса, если он уже известен
+func Login(ctx context.Context) string {
+	if info, ok := ctx.Value(infoKey{}).(*requestInfo); ok {
+		info.mu.RLock()
+		defer info.mu.RUnlock()
+		return info.login
+	}
+	return ""
+}
+
+// contextHandler добавляет к записям идентификатор запроса, логин и текущий спан из контекста
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle дополняет запись данными запроса
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if login := Login(ctx); login != "" {
+		r.AddAttrs(slog.String("login", login))
+	}
+	if sc := tracing.SpanFromContext(ctx).SpanContext(); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID.String()), slog.String("span_id", sc.SpanID.String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs сохраняет обертку для производных логгеров
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup сохраняет обертку для производных логгеров
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// levels уровни логирования по именам
+var levels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// Setup делает логгером по умолчанию JSON-логгер в w с уровнем level (debug, info, warn, error).
+// Стандартный пакет log после этого тоже пишет через него.
+func Setup(w io.Writer, level string) {
+	lvl, ok := levels[strings.ToLower(level)]
+	if !ok {
+		lvl = slog.LevelInfo
+	}
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: lvl})
+	slog.SetDefault(slog.New(contextHandler{handler}))
+}
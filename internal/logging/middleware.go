@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"cache-web-server/internal/utils"
+)
+
+// RequestIDHeader заголовок с идентификатором запроса
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID допустимый идентификатор запроса от клиента
+var validRequestID = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,128}$`)
+
+// newRequestID генерирует случайный идентификатор запроса
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// RequestIDMiddleware берет идентификатор запроса из X-Request-ID или генерирует новый,
+// кладет его в контекст и возвращает в заголовке ответа
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+	})
+}
+
+// AccessLogMiddleware пишет запись о каждом обработанном запросе.
+// Подключается после RequestIDMiddleware.
+func AccessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := utils.NewStatusWriter(w)
+
+		next.ServeHTTP(sw, r)
+
+		level := slog.LevelInfo
+		if sw.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.Log(r.Context(), level, "запрос обработан",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", sw.Status(),
+			"bytes", sw.Bytes(),
+			"duration_ms", time.Since(start).Milliseconds(),
+			"ip", utils.ClientIP(r),
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
@@ -0,0 +1,158 @@
+package loginguard
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Policy настройки защиты от перебора паролей
+type Policy struct {
+	// MaxLoginFailures неудачных попыток на логин до блокировки
+	MaxLoginFailures int
+	// MaxIPFailures неудачных попыток с одного IP до блокировки
+	MaxIPFailures int
+	// Window через сколько после последней неудачи или окончания блокировки счетчик сбрасывается
+	Window time.Duration
+	// BaseLockout длительность первой блокировки, каждая следующая вдвое дольше
+	BaseLockout time.Duration
+	// MaxLockout максимальная длительность блокировки
+	MaxLockout time.Duration
+}
+
+// Guard учитывает неудачные попытки входа по логину и по IP
+// и блокирует вход с экспоненциально растущей задержкой
+type Guard struct {
+	db     *sql.DB
+	policy Policy
+}
+
+// New создает Guard
+func New(db *sql.DB, policy Policy) *Guard {
+	return &Guard{db: db, policy: policy}
+}
+
+// loginKey ключ счетчика для логина
+func loginKey(login string) string {
+	return "login:" + login
+}
+
+// Share возвращает имя, под которым учитываются попытки подобрать пароль ссылки на документ.
+// Логины состоят только из латинских букв и цифр, поэтому оно не совпадет ни с одним логином.
+func Share(id string) string {
+	return "share:" + id
+}
+
+// ipKey ключ счетчика для IP
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check возвращает, сколько еще действует блокировка логина или IP (0 — вход разрешен)
+func (g *Guard) Check(ctx context.Context, login, ip string) (time.Duration, error) {
+	var seconds float64
+	query := `SELECT COALESCE(EXTRACT(EPOCH FROM MAX(locked_until) - NOW()), 0)
+		FROM login_attempts WHERE key IN ($1, $2) AND locked_until > NOW()`
+	if err := g.db.QueryRowContext(ctx, query, loginKey(login), ipKey(ip)).Scan(&seconds); err != nil {
+		return 0, fmt.Errorf("ошибка при проверке блокировки входа: %w", err)
+	}
+	if seconds <= 0 {
+		return 0, nil
+	}
+	return time.Duration(math.Ceil(seconds)) * time.Second, nil
+}
+
+// Fail учитывает неудачную попытку входа
+func (g *Guard) Fail(ctx context.Context, login, ip string) error {
+	if err := g.fail(ctx, loginKey(login), g.policy.MaxLoginFailures); err != nil {
+		return err
+	}
+	return g.fail(ctx, ipKey(ip), g.policy.MaxIPFailures)
+}
+
+// fail увеличивает счетчик и блокирует ключ, если попыток слишком много
+func (g *Guard) fail(ctx context.Context, key string, max int) error {
+	tx, err := g.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка при учете попытки входа: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO login_attempts (key, failures, last_failure) VALUES ($1, 0, NOW())
+		ON CONFLICT (key) DO NOTHING`
+	if _, err := tx.ExecContext(ctx, query, key); err != nil {
+		return fmt.Errorf("ошибка при учете попытки входа: %w", err)
+	}
+
+	var failures int
+	var idle float64
+	query = `SELECT failures, EXTRACT(EPOCH FROM NOW() - GREATEST(last_failure, locked_until))
+		FROM login_attempts WHERE key = $1 FOR UPDATE`
+	if err := tx.QueryRowContext(ctx, query, key).Scan(&failures, &idle); err != nil {
+		return fmt.Errorf("ошибка при учете попытки входа: %w", err)
+	}
+
+	failures, lockout := g.next(failures, time.Duration(idle*float64(time.Second)), max)
+	query = `UPDATE login_attempts SET failures = $2, last_failure = NOW(),
+			locked_until = CASE WHEN $3 > 0 THEN NOW() + make_interval(secs => $3) ELSE locked_until END
+		WHERE key = $1`
+	if _, err := tx.ExecContext(ctx, query, key, failures, lockout.Seconds()); err != nil {
+		return fmt.Errorf("ошибка при блокировке входа: %w", err)
+	}
+	return tx.Commit()
+}
+
+// next возвращает новое значение счетчика после неудачной попытки и длительность
+// блокировки (0 — без блокировки). idle — сколько прошло с последней неудачи
+// или с окончания блокировки, если она закончилась позже: попытки во время блокировки
+// отклоняются без учета, и иначе счетчик сбрасывался бы раньше, чем блокировка достигнет MaxLockout.
+func (g *Guard) next(failures int, idle time.Duration, max int) (int, time.Duration) {
+	if idle >= g.policy.Window {
+		failures = 0
+	}
+	failures++
+	if failures < max {
+		return failures, 0
+	}
+	return failures, g.lockout(failures - max)
+}
+
+// lockout длительность блокировки после n попыток сверх лимита
+func (g *Guard) lockout(n int) time.Duration {
+	if n > 30 {
+		return g.policy.MaxLockout
+	}
+	lockout := g.policy.BaseLockout * time.Duration(1<<n)
+	if lockout <= 0 || lockout > g.policy.MaxLockout {
+		return g.policy.MaxLockout
+	}
+	return lockout
+}
+
+// Succeed сбрасывает счетчик логина после успешного входа.
+// Счетчик IP не сбрасывается, чтобы свой аккаунт не помогал перебирать чужие.
+func (g *Guard) Succeed(ctx context.Context, login string) error {
+	return g.Unlock(ctx, login)
+}
+
+// Unlock снимает блокировку логина
+func (g *Guard) Unlock(ctx context.Context, login string) error {
+	if _, err := g.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE key = $1`, loginKey(login)); err != nil {
+		return fmt.Errorf("ошибка при снятии блокировки входа: %w", err)
+	}
+	return nil
+}
+
+// Cleanup удаляет счетчики, которые уже сброшены по времени.
+// Окно отсчитывается и от окончания блокировки, как в next.
+func (g *Guard) Cleanup(ctx context.Context) (int64, error) {
+	query := `DELETE FROM login_attempts
+		WHERE GREATEST(last_failure, locked_until) < NOW() - make_interval(secs => $1)`
+	res, err := g.db.ExecContext(ctx, query, g.policy.Window.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при очистке попыток входа: %w", err)
+	}
+	return res.RowsAffected()
+}
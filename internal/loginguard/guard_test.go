@@ -0,0 +1,72 @@
+package loginguard
+
+import (
+	"testing"
+	"time"
+)
+
+// attempts строка login_attempts в тесте
+type attempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// failAt повторяет Guard.fail над строкой в памяти в момент now
+func (g *Guard) failAt(a *attempts, now time.Time, max int) time.Duration {
+	since := a.lastFailure
+	if a.lockedUntil.After(since) {
+		since = a.lockedUntil
+	}
+	var lockout time.Duration
+	a.failures, lockout = g.next(a.failures, now.Sub(since), max)
+	a.lastFailure = now
+	if lockout > 0 {
+		a.lockedUntil = now.Add(lockout)
+	}
+	return lockout
+}
+
+func TestLockoutEscalatesToMax(t *testing.T) {
+	g := New(nil, Policy{
+		MaxLoginFailures: 5,
+		Window:           15 * time.Minute,
+		BaseLockout:      time.Minute,
+		MaxLockout:       time.Hour,
+	})
+
+	// Перебор с максимальной скоростью: каждая попытка сразу после окончания блокировки,
+	// попытки во время блокировки отклоняет Check и они не учитываются
+	var a attempts
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var lockouts []time.Duration
+	for i := 0; i < 12; i++ {
+		if a.lockedUntil.After(now) {
+			now = a.lockedUntil
+		}
+		if lockout := g.failAt(&a, now, 5); lockout > 0 {
+			lockouts = append(lockouts, lockout)
+		}
+		now = now.Add(time.Second)
+	}
+
+	want := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute,
+		16 * time.Minute, 32 * time.Minute, time.Hour, time.Hour}
+	if len(lockouts) != len(want) {
+		t.Fatalf("блокировки %v, ожидались %v", lockouts, want)
+	}
+	for i := range want {
+		if lockouts[i] != want[i] {
+			t.Fatalf("блокировки %v, ожидались %v", lockouts, want)
+		}
+	}
+
+	// Пауза короче окна после окончания блокировки счетчик не сбрасывает
+	if lockout := g.failAt(&a, a.lockedUntil.Add(14*time.Minute), 5); lockout != time.Hour {
+		t.Fatalf("после паузы внутри окна блокировка %s, ожидался час", lockout)
+	}
+	// Пауза дольше окна сбрасывает счетчик
+	if lockout := g.failAt(&a, a.lockedUntil.Add(15*time.Minute), 5); lockout != 0 || a.failures != 1 {
+		t.Fatalf("после окна: блокировка %s, счетчик %d", lockout, a.failures)
+	}
+}
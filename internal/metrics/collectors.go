@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"database/sql"
+)
+
+// RegisterDBStats регистрирует метрики пула соединений из db.Stats()
+func RegisterDBStats(db *sql.DB) {
+	stat := func(fn func(s sql.DBStats) float64) func() float64 {
+		return func() float64 { return fn(db.Stats()) }
+	}
+
+	NewGaugeFunc("db_pool_max_open_connections", "Максимальное число соединений с БД.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	NewGaugeFunc("db_pool_open_connections", "Открытые соединения с БД.",
+		stat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	NewGaugeFunc("db_pool_in_use_connections", "Занятые соединения с БД.",
+		stat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	NewGaugeFunc("db_pool_idle_connections", "Свободные соединения с БД.",
+		stat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	NewCounterFunc("db_pool_wait_count_total", "Сколько раз запрос ждал свободного соединения.",
+		stat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	NewCounterFunc("db_pool_wait_duration_seconds_total", "Суммарное время ожидания соединения в секундах.",
+		stat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	NewCounterFunc("db_pool_max_idle_closed_total", "Соединения, закрытые из-за лимита свободных.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }))
+	NewCounterFunc("db_pool_max_lifetime_closed_total", "Соединения, закрытые по времени жизни.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }))
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cache-web-server/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Метрики HTTP-запросов, метка route — шаблон маршрута chi, например /api/docs/{id}
+var (
+	requestsTotal = NewCounter("http_requests_total",
+		"Количество обработанных HTTP-запросов.", "method", "route", "status")
+	requestDuration = NewHistogram("http_request_duration_seconds",
+		"Время обработки HTTP-запросов в секундах.", DefBuckets, "method", "route")
+	requestBytes = NewCounter("http_request_body_bytes_total",
+		"Прочитано байт из тел запросов (загрузка документов).", "method", "route")
+	responseBytes = NewCounter("http_response_body_bytes_total",
+		"Отправлено байт в телах ответов (скачивание документов).", "method", "route")
+)
+
+// AuthFailures неудачные попытки аутентификации по причинам
+var AuthFailures = NewCounter("auth_failures_total",
+	"Количество неудачных попыток аутентификации.", "reason")
+
+// unmatchedRoute метка для запросов, не попавших ни в один маршрут
+const unmatchedRoute = "unmatched"
+
+// countingBody считает прочитанные байты тела запроса
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// Middleware собирает метрики всех запросов роутера.
+// Должен подключаться к корневому роутеру до объявления маршрутов.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		body := &countingBody{ReadCloser: r.Body}
+		if r.Body != nil {
+			r.Body = body
+		}
+		sw := utils.NewStatusWriter(w)
+
+		next.ServeHTTP(sw, r)
+
+		// Шаблон маршрута известен только после маршрутизации
+		route := unmatchedRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		requestsTotal.Inc(r.Method, route, strconv.Itoa(sw.Status()))
+		requestDuration.Observe(time.Since(start).Seconds(), r.Method, route)
+		requestBytes.Add(float64(body.n), r.Method, route)
+		responseBytes.Add(float64(sw.Bytes()), r.Method, route)
+	})
+}
@@ -0,0 +1,255 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Collector пишет свои метрики в текстовом формате Prometheus
+type Collector interface {
+	Collect(w io.Writer)
+}
+
+// Registry набор метрик, отдаваемых на /metrics
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []Collector
+}
+
+// NewRegistry создает пустой Registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Default реестр, в котором регистрируются метрики пакета
+var Default = NewRegistry()
+
+// Register добавляет метрику в реестр
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// Handler отдает метрики реестра в текстовом формате Prometheus
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		bw := bufio.NewWriter(w)
+		r.mu.RLock()
+		for _, c := range r.collectors {
+			c.Collect(bw)
+		}
+		r.mu.RUnlock()
+		bw.Flush()
+	})
+}
+
+// writeHeader пишет строки HELP и TYPE метрики
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, strings.ReplaceAll(help, "\n", " "), name, typ)
+}
+
+// labelEscaper экранирует значения меток
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels формирует {a="1",b="2"}
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + `="` + labelEscaper.Replace(values[i]) + `"`
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// formatValue форматирует значение метрики
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// seriesKey ключ серии по значениям меток
+func seriesKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// sortedKeys возвращает ключи серий по порядку, чтобы вывод был стабильным
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// counterSeries значение счетчика для набора меток
+type counterSeries struct {
+	labels []string
+	value  float64
+}
+
+// Counter монотонно растущий счетчик с метками
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+// NewCounter создает счетчик и регистрирует его в Default
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{name: name, help: help, labels: labels, series: map[string]*counterSeries{}}
+	Default.Register(c)
+	return c
+}
+
+// Inc увеличивает счетчик на 1
+func (c *Counter) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Add увеличивает счетчик на v, значения меток передаются в порядке объявления
+func (c *Counter) Add(v float64, labels ...string) {
+	if len(labels) != len(c.labels) {
+		panic(fmt.Sprintf("metrics: %s ожидает %d меток", c.name, len(c.labels)))
+	}
+	key := seriesKey(labels)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.series[key]
+	if !ok {
+		s = &counterSeries{labels: append([]string(nil), labels...)}
+		c.series[key] = s
+	}
+	s.value += v
+}
+
+// Collect пишет значения счетчика
+func (c *Counter) Collect(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, s.labels), formatValue(s.value))
+	}
+}
+
+// DefBuckets границы корзин гистограммы длительности запросов в секундах
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// histogramSeries значения гистограммы для набора меток
+type histogramSeries struct {
+	labels []string
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Histogram гистограмма с метками
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+// NewHistogram создает гистограмму и регистрирует ее в Default
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{name: name, help: help, labels: labels, buckets: buckets, series: map[string]*histogramSeries{}}
+	Default.Register(h)
+	return h
+}
+
+// Observe добавляет наблюдение
+func (h *Histogram) Observe(v float64, labels ...string) {
+	if len(labels) != len(h.labels) {
+		panic(fmt.Sprintf("metrics: %s ожидает %d меток", h.name, len(h.labels)))
+	}
+	key := seriesKey(labels)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labels: append([]string(nil), labels...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+// Collect пишет корзины, сумму и количество наблюдений
+func (h *Histogram) Collect(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	names := append(append([]string(nil), h.labels...), "le")
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		for i, bound := range h.buckets {
+			values := append(append([]string(nil), s.labels...), formatValue(bound))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(names, values), s.counts[i])
+		}
+		values := append(append([]string(nil), s.labels...), "+Inf")
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(names, values), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, s.labels), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, s.labels), s.count)
+	}
+}
+
+// funcMetric метрика без меток, значение которой читается при сборе
+type funcMetric struct {
+	name string
+	help string
+	typ  string
+	fn   func() float64
+}
+
+// Collect пишет текущее значение
+func (f *funcMetric) Collect(w io.Writer) {
+	writeHeader(w, f.name, f.help, f.typ)
+	fmt.Fprintf(w, "%s %s\n", f.name, formatValue(f.fn()))
+}
+
+// NewGaugeFunc регистрирует в Default метрику-значение, вычисляемую при сборе
+func NewGaugeFunc(name, help string, fn func() float64) {
+	Default.Register(&funcMetric{name: name, help: help, typ: "gauge", fn: fn})
+}
+
+// NewCounterFunc регистрирует в Default счетчик, который ведется вне пакета
+func NewCounterFunc(name, help string, fn func() float64) {
+	Default.Register(&funcMetric{name: name, help: help, typ: "counter", fn: fn})
+}
@@ -1,31 +1,216 @@
 package models
 
+import (
+	"fmt"
+	"net/mail"
+	"time"
+)
+
+// Роли пользователей
+const (
+	RoleAdmin    = "admin"
+	RoleUser     = "user"
+	RoleReadOnly = "readonly"
+)
+
+// ValidRole проверяет, что роль известна
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleUser || role == RoleReadOnly
+}
+
+// ValidEmail проверяет, что email задан одним адресом без имени
+func ValidEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
 // User модель пользователя
 type User struct {
 	Login string `json:"login"`
 	Pswd  string `json:"pswd"`
 	Token string `json:"token"`
+	Role  string `json:"role,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// UserInfo модель пользователя для администратора
+type UserInfo struct {
+	Login     string `json:"login"`
+	Role      string `json:"role"`
+	Email     string `json:"email,omitempty"`
+	Disabled  bool   `json:"disabled"`
+	MustReset bool   `json:"must_reset_password"`
+	Created   string `json:"created"`
+	Documents int    `json:"documents"`
+	// Bytes размер документов вне корзины, TrashBytes — документов в корзине
+	Bytes      int64 `json:"bytes"`
+	TrashBytes int64 `json:"trash_bytes"`
+	Sessions   int   `json:"sessions"`
+}
+
+// ClientCertificate привязка клиентского сертификата к пользователю.
+// Издатель и субъект задаются в формате RFC 2253, например CN=alice,O=Example.
+// Издатель обязателен: одинаковые субъекты могут выдать разные доверенные CA.
+type ClientCertificate struct {
+	Issuer  string `json:"issuer"`
+	Subject string `json:"subject"`
+}
+
+// Permission уровень доступа к документу
+type Permission string
+
+// Уровни доступа к документу по возрастанию
+const (
+	PermNone   Permission = ""
+	PermRead   Permission = "read"
+	PermWrite  Permission = "write"
+	PermManage Permission = "manage"
+	PermOwner  Permission = "owner"
+)
+
+// permRank порядок уровней доступа
+var permRank = map[Permission]int{
+	PermNone:   0,
+	PermRead:   1,
+	PermWrite:  2,
+	PermManage: 3,
+	PermOwner:  4,
+}
+
+// Valid проверяет, что уровень доступа можно выдать через grant
+func (p Permission) Valid() bool {
+	return p == PermRead || p == PermWrite || p == PermManage
+}
+
+// Allows проверяет, что уровень доступа не ниже требуемого
+func (p Permission) Allows(required Permission) bool {
+	return permRank[p] >= permRank[required]
 }
 
 // Meta модель метаданных документа
 type Meta struct {
-	Name   string   `json:"name"`
-	File   bool     `json:"file"`
-	Public bool     `json:"public"`
-	Token  string   `json:"token"`
-	Mime   string   `json:"mime"`
-	Grant  []string `json:"grant"`
+	Name    string                `json:"name"`
+	File    bool                  `json:"file"`
+	Public  bool                  `json:"public"`
+	Token   string                `json:"token"`
+	Mime    string                `json:"mime"`
+	Grant   []string              `json:"grant"`
+	Access  map[string]Permission `json:"access,omitempty"`
+	TTL     int64                 `json:"ttl,omitempty"`
+	Expires string                `json:"expires,omitempty"`
+}
+
+// MaxTTL максимальный срок хранения документа или действия ссылки.
+// Ограничение также не дает переполниться time.Duration при переводе ttl из секунд.
+const MaxTTL = 100 * 365 * 24 * time.Hour
+
+// ExpiresAt вычисляет момент истечения срока хранения документа относительно now.
+// Возвращает nil, если срок не задан.
+func (m Meta) ExpiresAt(now time.Time) (*time.Time, error) {
+	switch {
+	case m.TTL < 0:
+		return nil, fmt.Errorf("ttl не может быть отрицательным")
+	case m.TTL > 0 && m.Expires != "":
+		return nil, fmt.Errorf("нельзя указать одновременно ttl и expires")
+	case m.TTL > int64(MaxTTL/time.Second):
+		return nil, fmt.Errorf("ttl не может превышать %d секунд", int64(MaxTTL/time.Second))
+	case m.TTL > 0:
+		expires := now.Add(time.Duration(m.TTL) * time.Second)
+		return &expires, nil
+	case m.Expires != "":
+		expires, err := time.Parse(time.RFC3339, m.Expires)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный формат expires: %w", err)
+		}
+		if !expires.After(now) {
+			return nil, fmt.Errorf("expires должен быть в будущем")
+		}
+		if expires.Sub(now) > MaxTTL {
+			return nil, fmt.Errorf("expires не может быть дальше %s от текущего момента", MaxTTL)
+		}
+		return &expires, nil
+	}
+	return nil, nil
+}
+
+// Grants объединяет grant (только чтение) и access (явные уровни) в один набор
+func (m Meta) Grants() map[string]Permission {
+	grants := make(map[string]Permission, len(m.Grant)+len(m.Access))
+	for _, login := range m.Grant {
+		if login != "" {
+			grants[login] = PermRead
+		}
+	}
+	for login, perm := range m.Access {
+		if login != "" {
+			grants[login] = perm
+		}
+	}
+	return grants
 }
 
 // Document модель для представления документа
 type Document struct {
-	ID      string   `json:"id"`
+	ID      string                `json:"id"`
+	Name    string                `json:"name"`
+	Mime    string                `json:"mime"`
+	File    bool                  `json:"file"`
+	Public  bool                  `json:"public"`
+	Created string                `json:"created"`
+	Version int                   `json:"version"`
+	Expires string                `json:"expires,omitempty"`
+	Deleted string                `json:"deleted,omitempty"`
+	Grant   []string              `json:"grant"`
+	Access  map[string]Permission `json:"access,omitempty"`
+}
+
+// Version модель версии документа
+type Version struct {
+	Version int                   `json:"version"`
+	Name    string                `json:"name"`
+	Mime    string                `json:"mime"`
+	File    bool                  `json:"file"`
+	Public  bool                  `json:"public"`
+	Access  map[string]Permission `json:"access"`
+	Author  string                `json:"author"`
+	Created string                `json:"created"`
+}
+
+// ShareLink модель ссылки для доступа к документу без учетной записи
+type ShareLink struct {
+	ID           string `json:"id"`
+	DocID        string `json:"doc_id"`
+	URL          string `json:"url,omitempty"`
+	Expires      string `json:"expires"`
+	MaxDownloads *int   `json:"max_downloads,omitempty"`
+	Downloads    int    `json:"downloads"`
+	Password     bool   `json:"password"`
+	CreatedBy    string `json:"created_by"`
+	Created      string `json:"created"`
+}
+
+// GroupPrefix префикс получателя доступа, который ссылается на группу
+const GroupPrefix = "group:"
+
+// Group модель группы пользователей
+type Group struct {
 	Name    string   `json:"name"`
-	Mime    string   `json:"mime"`
-	File    bool     `json:"file"`
-	Public  bool     `json:"public"`
+	Owner   string   `json:"owner,omitempty"`
+	Members []string `json:"members"`
 	Created string   `json:"created"`
-	Grant   []string `json:"grant"`
+}
+
+// AuditEvent запись журнала аудита
+type AuditEvent struct {
+	ID        int64                  `json:"id"`
+	Time      string                 `json:"time"`
+	Actor     string                 `json:"actor"`
+	Action    string                 `json:"action"`
+	Target    string                 `json:"target,omitempty"`
+	IP        string                 `json:"ip,omitempty"`
+	UserAgent string                 `json:"user_agent,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
 }
 
 // APIResponse общая модель для всех методов
@@ -43,7 +228,8 @@ type Error struct {
 
 // Data модель ответа с данными
 type Data struct {
-	Docs []Document  `json:"doc,omitempty"`
-	JSON interface{} `json:"json,omitempty"`
-	File string      `json:"file,omitempty"`
+	Docs     []Document  `json:"doc,omitempty"`
+	Versions []Version   `json:"versions,omitempty"`
+	JSON     interface{} `json:"json,omitempty"`
+	File     string      `json:"file,omitempty"`
 }
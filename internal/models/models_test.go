@@ -0,0 +1,31 @@
+package models
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMetaExpiresAt(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	expires, err := Meta{TTL: 3600}.ExpiresAt(now)
+	if err != nil || !expires.Equal(now.Add(time.Hour)) {
+		t.Fatalf("срок %v, ошибка %v", expires, err)
+	}
+
+	tests := []Meta{
+		{TTL: -1},
+		{TTL: int64(MaxTTL/time.Second) + 1},
+		// Без ограничения такой ttl переполнял time.Duration и давал срок в прошлом
+		{TTL: math.MaxInt64 / 1000},
+		{TTL: 60, Expires: "2024-01-02T00:00:00Z"},
+		{Expires: "2023-12-31T00:00:00Z"},
+		{Expires: "9999-01-01T00:00:00Z"},
+	}
+	for _, m := range tests {
+		if expires, err := m.ExpiresAt(now); err == nil {
+			t.Errorf("ttl %d, expires %q: принят срок %v", m.TTL, m.Expires, expires)
+		}
+	}
+}
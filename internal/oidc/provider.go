@@ -0,0 +1,306 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Config настройки клиента OIDC
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// discovery документ /.well-known/openid-configuration
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDClaims утверждения ID-токена, нужные для сопоставления пользователя
+type IDClaims struct {
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	jwt.RegisteredClaims
+}
+
+// Provider провайдер идентификации (IdP).
+// Документ discovery и ключи загружаются при первом обращении и кэшируются.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu        sync.Mutex
+	doc       *discovery
+	keys      map[string]interface{}
+	keysFetch time.Time
+}
+
+// NewProvider создает провайдера. client можно подменить, например для работы с тестовым IdP.
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{cfg: cfg, client: client}
+}
+
+// Issuer возвращает издателя, указанного в настройках
+func (p *Provider) Issuer() string {
+	return p.cfg.Issuer
+}
+
+// RedirectURL возвращает адрес возврата пользователя после входа в IdP
+func (p *Provider) RedirectURL() string {
+	return p.cfg.RedirectURL
+}
+
+// discover загружает документ discovery
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.doc != nil {
+		return p.doc, nil
+	}
+
+	var doc discovery
+	wellKnown := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &doc); err != nil {
+		return nil, fmt.Errorf("ошибка при загрузке discovery: %w", err)
+	}
+	if doc.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("issuer в discovery (%s) не совпадает с настройками", doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("в discovery нет обязательных адресов")
+	}
+
+	p.doc = &doc
+	return p.doc, nil
+}
+
+// AuthCodeURL формирует адрес авторизации с PKCE (S256)
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return doc.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// Exchange обменивает код авторизации на ID-токен и проверяет его
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*IDClaims, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при обмене кода: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("IdP вернул статус %d при обмене кода", resp.StatusCode)
+	}
+
+	var tokenResp struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return nil, fmt.Errorf("некорректный ответ IdP: %w", err)
+	}
+	if tokenResp.IDToken == "" {
+		return nil, errors.New("в ответе IdP нет id_token")
+	}
+
+	return p.Verify(ctx, tokenResp.IDToken, nonce)
+}
+
+// Verify проверяет подпись и утверждения ID-токена
+func (p *Provider) Verify(ctx context.Context, idToken, nonce string) (*IDClaims, error) {
+	if _, err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	claims := &IDClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("некорректный id_token: %w", err)
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("в id_token нет sub")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("nonce в id_token не совпадает")
+	}
+	// При нескольких получателях токен должен быть выдан именно нам
+	if len(claims.Audience) > 1 {
+		var azp struct {
+			AZP string `json:"azp"`
+		}
+		if err := decodePayload(idToken, &azp); err != nil || azp.AZP != p.cfg.ClientID {
+			return nil, errors.New("azp в id_token не совпадает с client_id")
+		}
+	}
+
+	return claims, nil
+}
+
+// key возвращает открытый ключ IdP по kid, при неизвестном kid перечитывает JWKS
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	// Не перечитываем ключи чаще раза в минуту
+	if time.Since(p.keysFetch) < time.Minute && p.keys != nil {
+		return nil, fmt.Errorf("неизвестный ключ IdP: %s", kid)
+	}
+
+	keys, err := p.fetchKeys(ctx)
+	p.keysFetch = time.Now()
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("неизвестный ключ IdP: %s", kid)
+}
+
+// lookupKey ищет ключ в кэше. Без kid подходит единственный ключ.
+func (p *Provider) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// fetchKeys загружает JWKS IdP
+func (p *Provider) fetchKeys(ctx context.Context) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.doc.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("ошибка при загрузке JWKS: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+// getJSON выполняет GET и декодирует JSON-ответ
+func (p *Provider) getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("статус %d от %s", resp.StatusCode, target)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// decodePayload декодирует полезную нагрузку уже проверенного JWT
+func decodePayload(token string, v interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("некорректный JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, v)
+}
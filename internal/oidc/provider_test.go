@@ -0,0 +1,195 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIdP тестовый IdP: discovery, JWKS, страница авторизации и обмен кода с проверкой PKCE
+type mockIdP struct {
+	*httptest.Server
+	t   *testing.T
+	key *rsa.PrivateKey
+
+	// claims дополняют утверждения выдаваемого ID-токена
+	claims jwt.MapClaims
+	// code, challenge и nonce последней авторизации
+	code, challenge, nonce string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &mockIdP{t: t, key: key, claims: jwt.MapClaims{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", idp.authorize)
+	mux.HandleFunc("/token", idp.token)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// authorize сразу «логинит» пользователя и возвращает его с кодом на redirect_uri
+func (idp *mockIdP) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("response_type") != "code" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	idp.code, idp.challenge, idp.nonce = "code-"+q.Get("state"), q.Get("code_challenge"), q.Get("nonce")
+	http.Redirect(w, r, q.Get("redirect_uri")+"?code="+idp.code+"&state="+url.QueryEscape(q.Get("state")), http.StatusFound)
+}
+
+// token обменивает код на ID-токен, если code_verifier соответствует challenge
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Form.Get("code") != idp.code {
+		http.Error(w, "invalid_grant", http.StatusBadRequest)
+		return
+	}
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != idp.challenge {
+		http.Error(w, "invalid_grant", http.StatusBadRequest)
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   idp.URL,
+		"aud":   r.Form.Get("client_id"),
+		"sub":   "user-42",
+		"nonce": idp.nonce,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+	}
+	for k, v := range idp.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(idp.key)
+	if err != nil {
+		idp.t.Error(err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+}
+
+// login проходит авторизацию в IdP и возвращает полученный код
+func (idp *mockIdP) login(t *testing.T, p *Provider, state, nonce, verifier string) string {
+	t.Helper()
+	authURL, err := p.AuthCodeURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	back, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || back.Query().Get("state") != state {
+		t.Fatalf("IdP вернул пользователя на %q", resp.Header.Get("Location"))
+	}
+	return back.Query().Get("code")
+}
+
+func newTestProvider(idp *mockIdP) *Provider {
+	return NewProvider(Config{
+		Issuer:      idp.URL,
+		ClientID:    "cache-web-server",
+		RedirectURL: "https://cache.example.com/api/auth/oidc/callback",
+		Scopes:      []string{"openid", "email"},
+	}, idp.Client())
+}
+
+func TestProviderExchange(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.claims["email"] = "user@example.com"
+	idp.claims["email_verified"] = true
+	p := newTestProvider(idp)
+
+	code := idp.login(t, p, "state", "nonce", "verifier")
+	claims, err := p.Exchange(context.Background(), code, "verifier", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "user-42" || claims.Email != "user@example.com" || !claims.EmailVerified {
+		t.Fatalf("неожиданные утверждения: %+v", claims)
+	}
+}
+
+func TestProviderExchangeRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   jwt.MapClaims
+		verifier string
+		nonce    string
+		want     string
+	}{
+		{name: "чужой verifier", verifier: "other", nonce: "nonce", want: "статус 400"},
+		{name: "чужой nonce", verifier: "verifier", nonce: "other", want: "nonce"},
+		{name: "другой получатель", claims: jwt.MapClaims{"aud": "other-client"}, verifier: "verifier", nonce: "nonce", want: "aud"},
+		{name: "несколько получателей без azp", claims: jwt.MapClaims{"aud": []string{"cache-web-server", "other"}}, verifier: "verifier", nonce: "nonce", want: "azp"},
+		{name: "истекший токен", claims: jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}, verifier: "verifier", nonce: "nonce", want: "expired"},
+		{name: "другой издатель", claims: jwt.MapClaims{"iss": "https://evil.example.com"}, verifier: "verifier", nonce: "nonce", want: "iss"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			if tt.claims != nil {
+				idp.claims = tt.claims
+			}
+			p := newTestProvider(idp)
+
+			code := idp.login(t, p, "state", "nonce", "verifier")
+			_, err := p.Exchange(context.Background(), code, tt.verifier, tt.nonce)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ожидалась ошибка с %q, получено %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestProviderDiscoveryIssuerMismatch(t *testing.T) {
+	idp := newMockIdP(t)
+	p := NewProvider(Config{Issuer: idp.URL + "/", ClientID: "cache-web-server"}, idp.Client())
+
+	if _, err := p.AuthCodeURL(context.Background(), "state", "nonce", "verifier"); err == nil {
+		t.Fatal("issuer из discovery не проверен")
+	}
+}
@@ -0,0 +1,546 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cache-web-server/config"
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/repository"
+)
+
+// timeLayout формат дат в документах, как у TIMESTAMP::text в PostgreSQL
+const timeLayout = "2006-01-02 15:04:05.999999"
+
+// document документ со всеми версиями
+type document struct {
+	models.Document
+	owner    string
+	content  []byte
+	created  time.Time
+	expires  *time.Time
+	deleted  *time.Time
+	versions []version
+}
+
+// version неизменяемая версия документа
+type version struct {
+	models.Version
+	content []byte
+}
+
+// Documents хранилище документов в памяти. Подходит для тестов обработчиков
+// и запуска без базы данных, данные теряются при остановке.
+type Documents struct {
+	mu     sync.Mutex
+	docs   map[string]*document
+	groups map[string][]string
+	now    func() time.Time
+}
+
+// NewDocuments создает пустое хранилище
+func NewDocuments() *Documents {
+	return &Documents{
+		docs:   map[string]*document{},
+		groups: map[string][]string{},
+		now:    time.Now,
+	}
+}
+
+// AddGroup добавляет группу пользователей, которой можно выдавать доступ как group:<name>
+func (d *Documents) AddGroup(name string, members ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.groups[name] = append([]string(nil), members...)
+}
+
+// active возвращает документ, если он не в корзине и срок хранения не истек
+func (d *Documents) active(id string) (*document, error) {
+	doc, ok := d.docs[id]
+	if !ok || doc.deleted != nil {
+		return nil, repository.ErrNotFound
+	}
+	if doc.expires != nil && !doc.expires.After(d.now()) {
+		return nil, repository.ErrExpired
+	}
+	return doc, nil
+}
+
+// Access возвращает уровень доступа пользователя к документу
+func (d *Documents) Access(ctx context.Context, id, login string, trashed bool) (models.Permission, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	doc, ok := d.docs[id]
+	if !ok || (doc.deleted != nil) != trashed {
+		return models.PermNone, repository.ErrNotFound
+	}
+	if !trashed && doc.expires != nil && !doc.expires.After(d.now()) {
+		return models.PermNone, repository.ErrExpired
+	}
+
+	if doc.owner == login {
+		return models.PermOwner, nil
+	}
+
+	// Права могут быть выданы лично и через группы, берем наибольшее
+	var perm models.Permission
+	for grantee, p := range doc.Access {
+		if d.granted(grantee, login) && !perm.Allows(p) {
+			perm = p
+		}
+	}
+	if perm == models.PermNone && doc.Public {
+		perm = models.PermRead
+	}
+	return perm, nil
+}
+
+// granted проверяет, что получатель доступа — сам пользователь или его группа
+func (d *Documents) granted(grantee, login string) bool {
+	if grantee == login {
+		return true
+	}
+	name, ok := strings.CutPrefix(grantee, models.GroupPrefix)
+	if !ok {
+		return false
+	}
+	for _, member := range d.groups[name] {
+		if member == login {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGroups проверяет, что группы, которым выдается доступ, существуют
+func (d *Documents) checkGroups(grants map[string]models.Permission) error {
+	for login := range grants {
+		if name, ok := strings.CutPrefix(login, models.GroupPrefix); ok {
+			if _, exists := d.groups[name]; !exists {
+				return fmt.Errorf("%w: %s", repository.ErrUnknownGroup, name)
+			}
+		}
+	}
+	return nil
+}
+
+// Create сохраняет документ, его права доступа и первую версию
+func (d *Documents) Create(ctx context.Context, doc repository.NewDocument) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if existing, exists := d.docs[doc.ID]; exists {
+		switch {
+		case existing.deleted != nil:
+			return repository.ErrTrashed
+		case existing.expires != nil && !existing.expires.After(d.now()):
+			return repository.ErrExpired
+		}
+		return repository.ErrExists
+	}
+	if err := d.checkGroups(doc.Access); err != nil {
+		return err
+	}
+
+	now := d.now()
+	stored := &document{
+		Document: models.Document{
+			ID:      doc.ID,
+			Name:    doc.Name,
+			Mime:    doc.Mime,
+			File:    doc.File,
+			Public:  doc.Public,
+			Created: now.Format(timeLayout),
+			Version: 1,
+		},
+		owner:   doc.Owner,
+		content: doc.Content,
+		created: now,
+		expires: doc.Expires,
+	}
+	stored.setGrants(doc.Access)
+	if doc.Expires != nil {
+		stored.Expires = doc.Expires.UTC().Format(timeLayout)
+	}
+	stored.snapshot(doc.Owner, now)
+
+	d.docs[doc.ID] = stored
+	return nil
+}
+
+// setGrants заменяет права доступа документа
+func (doc *document) setGrants(grants map[string]models.Permission) {
+	doc.Access = maps.Clone(grants)
+	if doc.Access == nil {
+		doc.Access = map[string]models.Permission{}
+	}
+	doc.Grant = make([]string, 0, len(grants))
+	for login := range grants {
+		doc.Grant = append(doc.Grant, login)
+	}
+	sort.Strings(doc.Grant)
+}
+
+// snapshot сохраняет текущее состояние документа как версию
+// и удаляет версии, вышедшие за пределы хранения
+func (doc *document) snapshot(author string, now time.Time) {
+	doc.versions = append(doc.versions, version{
+		Version: models.Version{
+			Version: doc.Version,
+			Name:    doc.Name,
+			Mime:    doc.Mime,
+			File:    doc.File,
+			Public:  doc.Public,
+			Access:  maps.Clone(doc.Access),
+			Author:  author,
+			Created: now.Format(timeLayout),
+		},
+		content: doc.content,
+	})
+
+	if retention := config.VersionRetention(); retention > 0 && len(doc.versions) > retention {
+		doc.versions = append([]version(nil), doc.versions[len(doc.versions)-retention:]...)
+	}
+}
+
+// view возвращает копию метаданных документа для выдачи наружу
+func (doc *document) view() models.Document {
+	out := doc.Document
+	out.Grant = append([]string{}, doc.Grant...)
+	out.Access = maps.Clone(doc.Access)
+	return out
+}
+
+// List возвращает документы по фильтру
+func (d *Documents) List(ctx context.Context, filter repository.DocumentFilter) ([]models.Document, error) {
+	if filter.Field != "" && !containsString(repository.FilterFields, filter.Field) {
+		return nil, fmt.Errorf("неизвестное поле фильтра %s", filter.Field)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var found []*document
+	for id, doc := range d.docs {
+		if doc.owner != filter.Owner {
+			continue
+		}
+		if _, err := d.active(id); err != nil {
+			continue
+		}
+		if filter.Viewer != filter.Owner && !doc.Public && !d.visible(doc, filter.Viewer) {
+			continue
+		}
+		if filter.Field != "" && !matches(doc, filter.Field, filter.Value) {
+			continue
+		}
+		found = append(found, doc)
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Name != found[j].Name {
+			return found[i].Name < found[j].Name
+		}
+		return found[i].created.Before(found[j].created)
+	})
+	if filter.Limit > 0 && len(found) > filter.Limit {
+		found = found[:filter.Limit]
+	}
+
+	var docs []models.Document
+	for _, doc := range found {
+		docs = append(docs, doc.view())
+	}
+	return docs, nil
+}
+
+// visible проверяет, что пользователю выдан доступ к документу лично или через группу
+func (d *Documents) visible(doc *document, login string) bool {
+	for grantee := range doc.Access {
+		if d.granted(grantee, login) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches сравнивает поле документа со значением фильтра, как это делает PostgreSQL
+func matches(doc *document, field, value string) bool {
+	switch field {
+	case "name":
+		return doc.Name == value
+	case "mime":
+		return doc.Mime == value
+	case "file", "public":
+		want, err := strconv.ParseBool(value)
+		if err != nil {
+			return false
+		}
+		if field == "file" {
+			return doc.File == want
+		}
+		return doc.Public == want
+	}
+	return false
+}
+
+// Get возвращает документ с правами доступа и его содержимое
+func (d *Documents) Get(ctx context.Context, id string) (models.Document, []byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	doc, err := d.active(id)
+	if err != nil {
+		return models.Document{}, nil, repository.ErrNotFound
+	}
+	return doc.view(), doc.content, nil
+}
+
+// update проверяет версию документа, применяет fn и сохраняет новую версию
+func (d *Documents) update(id string, expected int, author string, fn func(doc *document) error) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	doc, err := d.active(id)
+	if err != nil || (expected != repository.AnyVersion && doc.Version != expected) {
+		return 0, repository.ErrVersionConflict
+	}
+
+	if err := fn(doc); err != nil {
+		return 0, err
+	}
+	doc.Version++
+	doc.snapshot(author, d.now())
+	return doc.Version, nil
+}
+
+// UpdateContent заменяет содержимое документа
+func (d *Documents) UpdateContent(ctx context.Context, id string, version int, content []byte, mime, author string) (int, error) {
+	return d.update(id, version, author, func(doc *document) error {
+		doc.content = content
+		doc.File = true
+		if mime != "" {
+			doc.Mime = mime
+		}
+		return nil
+	})
+}
+
+// UpdateMeta изменяет метаданные и права доступа документа
+func (d *Documents) UpdateMeta(ctx context.Context, id string, version int, author string, update func(doc *models.Document) error) (int, error) {
+	d.mu.Lock()
+	_, err := d.active(id)
+	d.mu.Unlock()
+	if err != nil {
+		return 0, repository.ErrNotFound
+	}
+
+	return d.update(id, version, author, func(doc *document) error {
+		changed := doc.view()
+		if err := update(&changed); err != nil {
+			return err
+		}
+		if err := d.checkGroups(changed.Access); err != nil {
+			return err
+		}
+		doc.Name = changed.Name
+		doc.Mime = changed.Mime
+		doc.Public = changed.Public
+		doc.setGrants(changed.Access)
+		return nil
+	})
+}
+
+// Trash перемещает документ в корзину
+func (d *Documents) Trash(ctx context.Context, id, login string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	doc, ok := d.docs[id]
+	if !ok || doc.deleted != nil {
+		return repository.ErrNotFound
+	}
+	now := d.now()
+	doc.deleted = &now
+	doc.Deleted = now.Format(timeLayout)
+	return nil
+}
+
+// ListTrash возвращает документы в корзине владельца
+func (d *Documents) ListTrash(ctx context.Context, owner string) ([]models.Document, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var found []*document
+	for _, doc := range d.docs {
+		if doc.owner == owner && doc.deleted != nil {
+			found = append(found, doc)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].deleted.After(*found[j].deleted) })
+
+	var docs []models.Document
+	for _, doc := range found {
+		view := doc.view()
+		view.Expires = ""
+		docs = append(docs, view)
+	}
+	return docs, nil
+}
+
+// Untrash возвращает документ из корзины
+func (d *Documents) Untrash(ctx context.Context, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	doc, ok := d.docs[id]
+	if !ok || doc.deleted == nil {
+		return repository.ErrNotFound
+	}
+	doc.deleted = nil
+	doc.Deleted = ""
+	return nil
+}
+
+// Purge окончательно удаляет документ из корзины
+func (d *Documents) Purge(ctx context.Context, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	doc, ok := d.docs[id]
+	if !ok || doc.deleted == nil {
+		return repository.ErrNotFound
+	}
+	delete(d.docs, id)
+	return nil
+}
+
+// Versions возвращает историю версий документа
+func (d *Documents) Versions(ctx context.Context, id string) ([]models.Version, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	doc, ok := d.docs[id]
+	if !ok {
+		return nil, nil
+	}
+	var versions []models.Version
+	for i := len(doc.versions) - 1; i >= 0; i-- {
+		v := doc.versions[i].Version
+		v.Access = maps.Clone(v.Access)
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+// GetVersion возвращает версию документа и ее содержимое
+func (d *Documents) GetVersion(ctx context.Context, id string, number int) (models.Version, []byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	v, ok := d.version(id, number)
+	if !ok {
+		return models.Version{}, nil, repository.ErrNotFound
+	}
+	out := v.Version
+	out.Access = maps.Clone(v.Access)
+	return out, v.content, nil
+}
+
+// version ищет версию документа
+func (d *Documents) version(id string, number int) (version, bool) {
+	doc, ok := d.docs[id]
+	if !ok {
+		return version{}, false
+	}
+	for _, v := range doc.versions {
+		if v.Version.Version == number {
+			return v, true
+		}
+	}
+	return version{}, false
+}
+
+// RestoreVersion восстанавливает содержимое и метаданные документа из версии
+func (d *Documents) RestoreVersion(ctx context.Context, id string, number, expected int, author string) (int, error) {
+	d.mu.Lock()
+	v, ok := d.version(id, number)
+	d.mu.Unlock()
+	if !ok {
+		return 0, repository.ErrNotFound
+	}
+
+	return d.update(id, expected, author, func(doc *document) error {
+		doc.Name = v.Name
+		doc.Mime = v.Mime
+		doc.File = v.File
+		doc.content = v.content
+		return nil
+	})
+}
+
+// ownerStats возвращает количество и размер активных документов владельца и размер документов в корзине
+func (d *Documents) ownerStats(owner string) (count int, size, trash int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, doc := range d.docs {
+		if doc.owner != owner {
+			continue
+		}
+		if doc.deleted != nil {
+			trash += int64(len(doc.content))
+			continue
+		}
+		count++
+		size += int64(len(doc.content))
+	}
+	return count, size, trash
+}
+
+// removeUser удаляет документы пользователя или передает их reassignTo,
+// а также отзывает выданные пользователю права
+func (d *Documents) removeUser(login, reassignTo string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for id, doc := range d.docs {
+		if doc.owner == login {
+			if reassignTo == "" {
+				delete(d.docs, id)
+				continue
+			}
+			// Новый владелец не должен оставаться в grant своих же документов
+			doc.owner = reassignTo
+			delete(doc.Access, reassignTo)
+		}
+		delete(doc.Access, login)
+		doc.setGrants(doc.Access)
+	}
+	for name, members := range d.groups {
+		kept := members[:0]
+		for _, member := range members {
+			if member != login {
+				kept = append(kept, member)
+			}
+		}
+		d.groups[name] = kept
+	}
+}
+
+// containsString проверяет наличие строки в срезе
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
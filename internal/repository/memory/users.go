@@ -0,0 +1,370 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/repository"
+)
+
+// user учетная запись с токенами сброса пароля
+type user struct {
+	repository.Account
+	created time.Time
+	resets  map[string]resetToken
+}
+
+// resetToken одноразовый токен сброса пароля
+type resetToken struct {
+	issuedBy string
+	expires  time.Time
+	used     bool
+}
+
+// Users хранилище учетных записей в памяти.
+// Статистика документов и удаление пользователя используют docs, если оно задано.
+type Users struct {
+	mu    sync.Mutex
+	users map[string]*user
+	// identities логины пользователей IdP по (issuer, subject)
+	identities map[[2]string]string
+	// certificates логины владельцев клиентских сертификатов
+	certificates map[models.ClientCertificate]string
+	docs         *Documents
+	now          func() time.Time
+}
+
+// NewUsers создает пустое хранилище учетных записей
+func NewUsers(docs *Documents) *Users {
+	return &Users{
+		users:        map[string]*user{},
+		identities:   map[[2]string]string{},
+		certificates: map[models.ClientCertificate]string{},
+		docs:         docs,
+		now:          time.Now,
+	}
+}
+
+// Create добавляет пользователя
+func (u *Users) Create(ctx context.Context, login, passwordHash, role, email string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.create(login, passwordHash, role, email)
+}
+
+// create добавляет пользователя, u.mu должен быть захвачен
+func (u *Users) create(login, passwordHash, role, email string) error {
+	if _, exists := u.users[login]; exists || u.emailTaken(email, login) {
+		return repository.ErrExists
+	}
+	u.users[login] = &user{
+		Account: repository.Account{Login: login, PasswordHash: passwordHash, Role: role, Email: email},
+		created: u.now(),
+		resets:  map[string]resetToken{},
+	}
+	return nil
+}
+
+// emailTaken проверяет, что email без учета регистра есть у другого пользователя
+func (u *Users) emailTaken(email, login string) bool {
+	if email == "" {
+		return false
+	}
+	for _, account := range u.users {
+		if account.Login != login && strings.EqualFold(account.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get возвращает учетную запись
+func (u *Users) Get(ctx context.Context, login string) (repository.Account, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	account, ok := u.users[login]
+	if !ok {
+		return repository.Account{}, repository.ErrNotFound
+	}
+	return account.Account, nil
+}
+
+// Exists сообщает, есть ли пользователь с таким логином
+func (u *Users) Exists(ctx context.Context, login string) (bool, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	_, ok := u.users[login]
+	return ok, nil
+}
+
+// FindByEmail возвращает логин пользователя с email без учета регистра
+func (u *Users) FindByEmail(ctx context.Context, email string) (string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, account := range u.users {
+		if email != "" && strings.EqualFold(account.Email, email) {
+			return account.Login, nil
+		}
+	}
+	return "", repository.ErrNotFound
+}
+
+// AdminExists сообщает, есть ли хотя бы один администратор
+func (u *Users) AdminExists(ctx context.Context) (bool, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, account := range u.users {
+		if account.Role == models.RoleAdmin {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// List возвращает пользователей со статистикой использования.
+// Сессии хранятся отдельно, поэтому их количество всегда 0.
+func (u *Users) List(ctx context.Context) ([]models.UserInfo, error) {
+	u.mu.Lock()
+	users := []models.UserInfo{}
+	for _, account := range u.users {
+		users = append(users, models.UserInfo{
+			Login:     account.Login,
+			Role:      account.Role,
+			Email:     account.Email,
+			Disabled:  account.Disabled,
+			MustReset: account.MustReset,
+			Created:   account.created.Format(timeLayout),
+		})
+	}
+	u.mu.Unlock()
+
+	sort.Slice(users, func(i, j int) bool { return users[i].Login < users[j].Login })
+	if u.docs != nil {
+		for i := range users {
+			users[i].Documents, users[i].Bytes, users[i].TrashBytes = u.docs.ownerStats(users[i].Login)
+		}
+	}
+	return users, nil
+}
+
+// change применяет fn к учетной записи, ErrNotFound — пользователя нет
+func (u *Users) change(login string, fn func(account *user)) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	account, ok := u.users[login]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	fn(account)
+	return nil
+}
+
+// SetPassword сохраняет новый хэш пароля и снимает требование смены пароля
+func (u *Users) SetPassword(ctx context.Context, login, passwordHash string) error {
+	return u.change(login, func(account *user) {
+		account.PasswordHash = passwordHash
+		account.MustReset = false
+	})
+}
+
+// SetEmail задает email пользователя, пустой email удаляет его
+func (u *Users) SetEmail(ctx context.Context, login, email string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	account, ok := u.users[login]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if u.emailTaken(email, login) {
+		return repository.ErrExists
+	}
+	account.Email = email
+	return nil
+}
+
+// SetDisabled отключает или включает учетную запись
+func (u *Users) SetDisabled(ctx context.Context, login string, disabled bool) error {
+	return u.change(login, func(account *user) { account.Disabled = disabled })
+}
+
+// RequireReset требует от пользователя сменить пароль
+func (u *Users) RequireReset(ctx context.Context, login string) error {
+	return u.change(login, func(account *user) { account.MustReset = true })
+}
+
+// IssueResetToken сохраняет хэш токена сброса пароля
+func (u *Users) IssueResetToken(ctx context.Context, login, tokenHash, issuedBy string, ttl time.Duration) error {
+	now := u.now()
+	return u.change(login, func(account *user) {
+		account.MustReset = true
+		for hash, token := range account.resets {
+			token.used = true
+			account.resets[hash] = token
+		}
+		account.resets[tokenHash] = resetToken{issuedBy: issuedBy, expires: now.Add(ttl)}
+	})
+}
+
+// ResetPassword гасит токен сброса и сохраняет новый хэш пароля
+func (u *Users) ResetPassword(ctx context.Context, login, tokenHash, passwordHash string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	account, ok := u.users[login]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	token, ok := account.resets[tokenHash]
+	if !ok || token.used || !token.expires.After(u.now()) {
+		return repository.ErrNotFound
+	}
+
+	token.used = true
+	account.resets[tokenHash] = token
+	account.PasswordHash = passwordHash
+	account.MustReset = false
+	return nil
+}
+
+// FindByIdentity возвращает логин, привязанный к пользователю IdP
+func (u *Users) FindByIdentity(ctx context.Context, issuer, subject string) (string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	login, ok := u.identities[[2]string{issuer, subject}]
+	if !ok {
+		return "", repository.ErrNotFound
+	}
+	return login, nil
+}
+
+// LinkIdentity привязывает пользователя IdP к учетной записи
+func (u *Users) LinkIdentity(ctx context.Context, issuer, subject, login string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if _, ok := u.users[login]; !ok {
+		return repository.ErrNotFound
+	}
+	u.link(issuer, subject, login)
+	return nil
+}
+
+// link сохраняет привязку, если ее еще нет, u.mu должен быть захвачен
+func (u *Users) link(issuer, subject, login string) {
+	key := [2]string{issuer, subject}
+	if _, exists := u.identities[key]; !exists {
+		u.identities[key] = login
+	}
+}
+
+// CreateOIDC создает учетную запись пользователя IdP вместе с привязкой
+func (u *Users) CreateOIDC(ctx context.Context, login, passwordHash, email, issuer, subject string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if err := u.create(login, passwordHash, models.RoleUser, email); err != nil {
+		return err
+	}
+	u.link(issuer, subject, login)
+	return nil
+}
+
+// Certificates возвращает клиентские сертификаты пользователя
+func (u *Users) Certificates(ctx context.Context, login string) ([]models.ClientCertificate, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	certificates := []models.ClientCertificate{}
+	for cert, owner := range u.certificates {
+		if owner == login {
+			certificates = append(certificates, cert)
+		}
+	}
+	sort.Slice(certificates, func(i, j int) bool {
+		if certificates[i].Issuer != certificates[j].Issuer {
+			return certificates[i].Issuer < certificates[j].Issuer
+		}
+		return certificates[i].Subject < certificates[j].Subject
+	})
+	return certificates, nil
+}
+
+// FindByCertificate возвращает логин, которому привязан сертификат
+func (u *Users) FindByCertificate(ctx context.Context, cert models.ClientCertificate) (string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	login, ok := u.certificates[cert]
+	if !ok {
+		return "", repository.ErrNotFound
+	}
+	return login, nil
+}
+
+// AddCertificate привязывает клиентский сертификат к пользователю
+func (u *Users) AddCertificate(ctx context.Context, login string, cert models.ClientCertificate) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if _, ok := u.users[login]; !ok {
+		return repository.ErrNotFound
+	}
+	if _, exists := u.certificates[cert]; exists {
+		return repository.ErrExists
+	}
+	u.certificates[cert] = login
+	return nil
+}
+
+// RemoveCertificate отвязывает сертификат от пользователя
+func (u *Users) RemoveCertificate(ctx context.Context, login string, cert models.ClientCertificate) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.certificates[cert] != login {
+		return repository.ErrNotFound
+	}
+	delete(u.certificates, cert)
+	return nil
+}
+
+// Delete удаляет пользователя и его документы или передает документы reassignTo
+func (u *Users) Delete(ctx context.Context, login, reassignTo string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if _, ok := u.users[login]; !ok {
+		return repository.ErrNotFound
+	}
+	if _, ok := u.users[reassignTo]; reassignTo != "" && !ok {
+		return repository.ErrUnknownTarget
+	}
+
+	if u.docs != nil {
+		u.docs.removeUser(login, reassignTo)
+	}
+	// Привязки IdP и сертификаты удаляются вместе с пользователем, как ON DELETE CASCADE в БД
+	for key, owner := range u.identities {
+		if owner == login {
+			delete(u.identities, key)
+		}
+	}
+	for cert, owner := range u.certificates {
+		if owner == login {
+			delete(u.certificates, cert)
+		}
+	}
+	delete(u.users, login)
+	return nil
+}
@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/repository"
+)
+
+func TestDeleteUserLeavesGroups(t *testing.T) {
+	ctx := context.Background()
+	docs := NewDocuments()
+	users := NewUsers(docs)
+	for _, login := range []string{"alice", "bob"} {
+		if err := users.Create(ctx, login, "hash", models.RoleUser, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	docs.AddGroup("team", "alice", "bob")
+	err := docs.Create(ctx, repository.NewDocument{
+		ID:     "plan",
+		Name:   "plan.txt",
+		Owner:  "alice",
+		Access: map[string]models.Permission{models.GroupPrefix + "team": models.PermWrite},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := users.Delete(ctx, "bob", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Новый пользователь с тем же логином не получает доступ через группы прежнего
+	if err := users.Create(ctx, "bob", "hash", models.RoleUser, ""); err != nil {
+		t.Fatal(err)
+	}
+	perm, err := docs.Access(ctx, "plan", "bob", false)
+	if err != nil || perm != models.PermNone {
+		t.Fatalf("доступ %q после удаления пользователя, ошибка %v", perm, err)
+	}
+	if members := docs.groups["team"]; len(members) != 1 || members[0] != "alice" {
+		t.Fatalf("участники группы: %v", members)
+	}
+}
+
+func TestListSeparatesTrashBytes(t *testing.T) {
+	ctx := context.Background()
+	docs := NewDocuments()
+	users := NewUsers(docs)
+	if err := users.Create(ctx, "alice", "hash", models.RoleUser, ""); err != nil {
+		t.Fatal(err)
+	}
+	for id, content := range map[string]string{"kept": "12345", "trashed": "123"} {
+		if err := docs.Create(ctx, repository.NewDocument{ID: id, Name: id, Owner: "alice", File: true, Content: []byte(content)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := docs.Trash(ctx, "trashed", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := users.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := list[0]; info.Documents != 1 || info.Bytes != 5 || info.TrashBytes != 3 {
+		t.Fatalf("статистика %+v", info)
+	}
+}
@@ -0,0 +1,523 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"cache-web-server/config"
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/repository"
+)
+
+// queryer общий интерфейс для *sql.DB и *sql.Tx
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Documents хранилище документов в PostgreSQL
+type Documents struct {
+	db *sql.DB
+}
+
+// NewDocuments создает Documents
+func NewDocuments(db *sql.DB) *Documents {
+	return &Documents{db: db}
+}
+
+// inTx выполняет fn в транзакции
+func inTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Access возвращает уровень доступа пользователя к документу
+func (d *Documents) Access(ctx context.Context, id, login string, trashed bool) (models.Permission, error) {
+	var owner string
+	var public, expired bool
+	query := `SELECT owner, public, COALESCE(expires_at <= NOW(), FALSE) FROM documents
+		WHERE id = $1 AND (deleted_at IS NOT NULL) = $2`
+	err := d.db.QueryRowContext(ctx, query, id, trashed).Scan(&owner, &public, &expired)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.PermNone, repository.ErrNotFound
+	}
+	if err != nil {
+		return models.PermNone, err
+	}
+	if expired && !trashed {
+		return models.PermNone, repository.ErrExpired
+	}
+
+	if owner == login {
+		return models.PermOwner, nil
+	}
+
+	// Права могут быть выданы лично и через группы, берем наибольшее
+	var perm models.Permission
+	query = `SELECT g.permission FROM document_grants g WHERE g.doc_id = $1 AND ` + grantMatch(2)
+	rows, err := d.db.QueryContext(ctx, query, id, login)
+	if err != nil {
+		return models.PermNone, fmt.Errorf("ошибка при чтении прав доступа: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p models.Permission
+		if err := rows.Scan(&p); err != nil {
+			return models.PermNone, fmt.Errorf("ошибка при чтении прав доступа: %w", err)
+		}
+		if !perm.Allows(p) {
+			perm = p
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return models.PermNone, fmt.Errorf("ошибка при чтении прав доступа: %w", err)
+	}
+
+	if perm == models.PermNone && public {
+		perm = models.PermRead
+	}
+
+	return perm, nil
+}
+
+// grantMatch условие на строку document_grants g, выданную пользователю
+// с логином из параметра $n лично или через одну из его групп
+func grantMatch(n int) string {
+	return fmt.Sprintf(`(g.login = $%[1]d OR g.login IN (
+		SELECT '%[2]s' || m.group_name FROM group_members m WHERE m.login = $%[1]d))`, n, models.GroupPrefix)
+}
+
+// Create сохраняет документ, его права доступа и первую версию
+func (d *Documents) Create(ctx context.Context, doc repository.NewDocument) error {
+	return inTx(ctx, d.db, func(tx *sql.Tx) error {
+		var id string
+		query := `INSERT INTO documents (id, name, mime, has_file, public, owner, file, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (id) DO NOTHING RETURNING id`
+		err := tx.QueryRowContext(ctx, query, doc.ID, doc.Name, doc.Mime, doc.File, doc.Public, doc.Owner, doc.Content, doc.Expires).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return existingDocument(ctx, tx, doc.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка при сохранении документа: %w", err)
+		}
+		if err := saveGrants(ctx, tx, doc.ID, doc.Access); err != nil {
+			return err
+		}
+		return snapshotVersion(ctx, tx, doc.ID, doc.Owner)
+	})
+}
+
+// existingDocument объясняет, почему идентификатор занят: ErrTrashed — документ в корзине,
+// ErrExpired — срок хранения истек, но документ еще не удален, иначе ErrExists
+func existingDocument(ctx context.Context, db queryer, id string) error {
+	var trashed, expired bool
+	query := `SELECT deleted_at IS NOT NULL, COALESCE(expires_at <= NOW(), FALSE) FROM documents WHERE id = $1`
+	err := db.QueryRowContext(ctx, query, id).Scan(&trashed, &expired)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return repository.ErrExists
+	case err != nil:
+		return fmt.Errorf("ошибка при чтении документа: %w", err)
+	case trashed:
+		return repository.ErrTrashed
+	case expired:
+		return repository.ErrExpired
+	}
+	return repository.ErrExists
+}
+
+// filterColumns колонки, по которым разрешена фильтрация списка документов
+var filterColumns = map[string]string{
+	"name":   "name",
+	"mime":   "mime",
+	"file":   "has_file",
+	"public": "public",
+}
+
+// List возвращает документы по фильтру
+func (d *Documents) List(ctx context.Context, filter repository.DocumentFilter) ([]models.Document, error) {
+	query := `SELECT id, name, mime, has_file, public, created, version, COALESCE((expires_at AT TIME ZONE 'UTC')::text, '') FROM documents`
+	conditions := []string{"owner = $1"}
+	params := []interface{}{filter.Owner}
+
+	// Чужие документы видны, только если они публичные или доступ выдан
+	if filter.Viewer != filter.Owner {
+		conditions = append(conditions, fmt.Sprintf(
+			"(public OR EXISTS (SELECT 1 FROM document_grants g WHERE g.doc_id = documents.id AND %s))",
+			grantMatch(len(params)+1)))
+		params = append(params, filter.Viewer)
+	}
+
+	if filter.Field != "" {
+		column, ok := filterColumns[filter.Field]
+		if !ok {
+			return nil, fmt.Errorf("неизвестное поле фильтра %s", filter.Field)
+		}
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", column, len(params)+1))
+		params = append(params, filter.Value)
+	}
+
+	// Документы из корзины и с истекшим сроком хранения в списке не показываем
+	conditions = append(conditions, "deleted_at IS NULL", "(expires_at IS NULL OR expires_at > NOW())")
+	query += " WHERE " + strings.Join(conditions, " AND ") + " ORDER BY name, created"
+
+	if filter.Limit > 0 {
+		query += " LIMIT $" + strconv.Itoa(len(params)+1)
+		params = append(params, filter.Limit)
+	}
+
+	rows, err := d.db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при чтении документов: %w", err)
+	}
+	defer rows.Close()
+
+	var docs []models.Document
+	for rows.Next() {
+		var doc models.Document
+		if err := rows.Scan(&doc.ID, &doc.Name, &doc.Mime, &doc.File, &doc.Public, &doc.Created, &doc.Version, &doc.Expires); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении документов: %w", err)
+		}
+		docs = append(docs, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при чтении документов: %w", err)
+	}
+	rows.Close()
+
+	if err := fillGrants(ctx, d.db, docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// Get возвращает документ с правами доступа и его содержимое
+func (d *Documents) Get(ctx context.Context, id string) (models.Document, []byte, error) {
+	query := `SELECT id, name, mime, has_file, public, created, version, COALESCE((expires_at AT TIME ZONE 'UTC')::text, ''), file
+		FROM documents WHERE id = $1 AND deleted_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())`
+	var doc models.Document
+	var file []byte
+	err := d.db.QueryRowContext(ctx, query, id).Scan(&doc.ID, &doc.Name, &doc.Mime, &doc.File, &doc.Public, &doc.Created, &doc.Version, &doc.Expires, &file)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Document{}, nil, repository.ErrNotFound
+	}
+	if err != nil {
+		return models.Document{}, nil, fmt.Errorf("ошибка при чтении документа: %w", err)
+	}
+
+	docs := []models.Document{doc}
+	if err := fillGrants(ctx, d.db, docs); err != nil {
+		return models.Document{}, nil, err
+	}
+	return docs[0], file, nil
+}
+
+// updateVersioned выполняет UPDATE документа с проверкой версии и возвращает новую версию.
+// В запросе $1 — id документа, $2 — ожидаемая версия (AnyVersion для любой).
+func updateVersioned(ctx context.Context, db queryer, set string, args ...interface{}) (int, error) {
+	query := `UPDATE documents SET ` + set + `, version = version + 1, updated = NOW()
+		WHERE id = $1 AND deleted_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+			AND ($2 = -1 OR version = $2) RETURNING version`
+
+	var version int
+	err := db.QueryRowContext(ctx, query, args...).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, repository.ErrVersionConflict
+	}
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при изменении документа: %w", err)
+	}
+	return version, nil
+}
+
+// UpdateContent заменяет содержимое документа
+func (d *Documents) UpdateContent(ctx context.Context, id string, version int, content []byte, mime, author string) (int, error) {
+	var next int
+	err := inTx(ctx, d.db, func(tx *sql.Tx) error {
+		var err error
+		next, err = updateVersioned(ctx, tx, `file = $3, has_file = TRUE, mime = COALESCE(NULLIF($4, ''), mime)`,
+			id, version, content, mime)
+		if err != nil {
+			return err
+		}
+		return snapshotVersion(ctx, tx, id, author)
+	})
+	return next, err
+}
+
+// UpdateMeta изменяет метаданные и права доступа документа
+func (d *Documents) UpdateMeta(ctx context.Context, id string, version int, author string, update func(doc *models.Document) error) (int, error) {
+	var next int
+	err := inTx(ctx, d.db, func(tx *sql.Tx) error {
+		// Читаем текущее состояние документа под блокировкой
+		docs := []models.Document{{ID: id}}
+		query := `SELECT name, mime, public FROM documents
+			WHERE id = $1 AND deleted_at IS NULL AND (expires_at IS NULL OR expires_at > NOW()) FOR UPDATE`
+		err := tx.QueryRowContext(ctx, query, id).Scan(&docs[0].Name, &docs[0].Mime, &docs[0].Public)
+		if errors.Is(err, sql.ErrNoRows) {
+			return repository.ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка при чтении документа: %w", err)
+		}
+		if err := fillGrants(ctx, tx, docs); err != nil {
+			return err
+		}
+
+		doc := docs[0]
+		before := make(map[string]models.Permission, len(doc.Access))
+		for login, perm := range doc.Access {
+			before[login] = perm
+		}
+		if err := update(&doc); err != nil {
+			return err
+		}
+
+		next, err = updateVersioned(ctx, tx, `name = $3, mime = $4, public = $5`,
+			id, version, doc.Name, doc.Mime, doc.Public)
+		if err != nil {
+			return err
+		}
+
+		if !reflect.DeepEqual(before, doc.Access) {
+			if err := saveGrants(ctx, tx, id, doc.Access); err != nil {
+				return err
+			}
+		}
+		return snapshotVersion(ctx, tx, id, author)
+	})
+	return next, err
+}
+
+// Trash перемещает документ в корзину
+func (d *Documents) Trash(ctx context.Context, id, login string) error {
+	query := `UPDATE documents SET deleted_at = NOW(), deleted_by = $2 WHERE id = $1 AND deleted_at IS NULL`
+	return execOne(ctx, d.db, query, id, login)
+}
+
+// ListTrash возвращает документы в корзине владельца
+func (d *Documents) ListTrash(ctx context.Context, owner string) ([]models.Document, error) {
+	query := `SELECT id, name, mime, has_file, public, created, version, deleted_at FROM documents
+		WHERE owner = $1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC`
+	rows, err := d.db.QueryContext(ctx, query, owner)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при чтении корзины: %w", err)
+	}
+	defer rows.Close()
+
+	var docs []models.Document
+	for rows.Next() {
+		var doc models.Document
+		if err := rows.Scan(&doc.ID, &doc.Name, &doc.Mime, &doc.File, &doc.Public, &doc.Created, &doc.Version, &doc.Deleted); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении корзины: %w", err)
+		}
+		docs = append(docs, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при чтении корзины: %w", err)
+	}
+	rows.Close()
+
+	if err := fillGrants(ctx, d.db, docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// Untrash возвращает документ из корзины
+func (d *Documents) Untrash(ctx context.Context, id string) error {
+	query := `UPDATE documents SET deleted_at = NULL, deleted_by = NULL WHERE id = $1 AND deleted_at IS NOT NULL`
+	return execOne(ctx, d.db, query, id)
+}
+
+// Purge окончательно удаляет документ из корзины
+func (d *Documents) Purge(ctx context.Context, id string) error {
+	return execOne(ctx, d.db, `DELETE FROM documents WHERE id = $1 AND deleted_at IS NOT NULL`, id)
+}
+
+// execOne выполняет запрос и возвращает ErrNotFound, если он не затронул ни одной строки
+func execOne(ctx context.Context, db queryer, query string, args ...interface{}) error {
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// versionColumns колонки, которые читает scanVersion
+const versionColumns = `version, name, mime, has_file, public, access, author, created`
+
+// scanVersion читает версию документа из строки результата
+func scanVersion(row interface{ Scan(...interface{}) error }, v *models.Version, extra ...interface{}) error {
+	var access []byte
+	var author sql.NullString
+	dest := append([]interface{}{&v.Version, &v.Name, &v.Mime, &v.File, &v.Public, &access, &author, &v.Created}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+	v.Author = author.String
+	return json.Unmarshal(access, &v.Access)
+}
+
+// Versions возвращает историю версий документа
+func (d *Documents) Versions(ctx context.Context, id string) ([]models.Version, error) {
+	query := `SELECT ` + versionColumns + ` FROM document_versions WHERE doc_id = $1 ORDER BY version DESC`
+	rows, err := d.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при чтении версий: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []models.Version
+	for rows.Next() {
+		var v models.Version
+		if err := scanVersion(rows, &v); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении версий: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// GetVersion возвращает версию документа и ее содержимое
+func (d *Documents) GetVersion(ctx context.Context, id string, version int) (models.Version, []byte, error) {
+	return getVersion(ctx, d.db, id, version)
+}
+
+// getVersion читает версию документа вместе с содержимым
+func getVersion(ctx context.Context, db queryer, id string, version int) (models.Version, []byte, error) {
+	var v models.Version
+	var file []byte
+	query := `SELECT ` + versionColumns + `, file FROM document_versions WHERE doc_id = $1 AND version = $2`
+	err := scanVersion(db.QueryRowContext(ctx, query, id, version), &v, &file)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Version{}, nil, repository.ErrNotFound
+	}
+	if err != nil {
+		return models.Version{}, nil, fmt.Errorf("ошибка при чтении версии: %w", err)
+	}
+	return v, file, nil
+}
+
+// RestoreVersion восстанавливает содержимое и метаданные документа из версии
+func (d *Documents) RestoreVersion(ctx context.Context, id string, version, expected int, author string) (int, error) {
+	var next int
+	err := inTx(ctx, d.db, func(tx *sql.Tx) error {
+		v, file, err := getVersion(ctx, tx, id, version)
+		if err != nil {
+			return err
+		}
+
+		next, err = updateVersioned(ctx, tx, `name = $3, mime = $4, has_file = $5, file = $6`,
+			id, expected, v.Name, v.Mime, v.File, file)
+		if err != nil {
+			return err
+		}
+		return snapshotVersion(ctx, tx, id, author)
+	})
+	return next, err
+}
+
+// saveGrants заменяет права доступа к документу.
+// Получатель вида group:<name> ссылается на группу пользователей.
+func saveGrants(ctx context.Context, db queryer, id string, grants map[string]models.Permission) error {
+	if _, err := db.ExecContext(ctx, `DELETE FROM document_grants WHERE doc_id = $1`, id); err != nil {
+		return fmt.Errorf("ошибка при удалении прав доступа: %w", err)
+	}
+
+	query := `INSERT INTO document_grants (doc_id, login, permission) VALUES ($1, $2, $3)`
+	for login, perm := range grants {
+		// Группа должна существовать, иначе доступ получит группа, созданная позже с тем же именем
+		if name, ok := strings.CutPrefix(login, models.GroupPrefix); ok {
+			var exists bool
+			err := db.QueryRowContext(ctx, `SELECT TRUE FROM groups WHERE name = $1`, name).Scan(&exists)
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%w: %s", repository.ErrUnknownGroup, name)
+			}
+			if err != nil {
+				return fmt.Errorf("ошибка при чтении группы: %w", err)
+			}
+		}
+		if _, err := db.ExecContext(ctx, query, id, login, perm); err != nil {
+			return fmt.Errorf("ошибка при сохранении прав доступа: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// fillGrants заполняет grant и access у документов
+func fillGrants(ctx context.Context, db queryer, docs []models.Document) error {
+	for i := range docs {
+		rows, err := db.QueryContext(ctx, `SELECT login, permission FROM document_grants WHERE doc_id = $1 ORDER BY login`, docs[i].ID)
+		if err != nil {
+			return fmt.Errorf("ошибка при чтении прав доступа: %w", err)
+		}
+
+		docs[i].Grant = []string{}
+		docs[i].Access = map[string]models.Permission{}
+		for rows.Next() {
+			var login string
+			var perm models.Permission
+			if err := rows.Scan(&login, &perm); err != nil {
+				rows.Close()
+				return fmt.Errorf("ошибка при чтении прав доступа: %w", err)
+			}
+			docs[i].Grant = append(docs[i].Grant, login)
+			docs[i].Access[login] = perm
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return fmt.Errorf("ошибка при чтении прав доступа: %w", err)
+		}
+		rows.Close()
+	}
+
+	return nil
+}
+
+// snapshotVersion сохраняет текущее состояние документа как неизменяемую версию
+// и удаляет версии, вышедшие за пределы хранения
+func snapshotVersion(ctx context.Context, db queryer, id, login string) error {
+	query := `INSERT INTO document_versions (doc_id, version, name, mime, has_file, public, access, file, author)
+		SELECT d.id, d.version, d.name, d.mime, d.has_file, d.public,
+			COALESCE((SELECT jsonb_object_agg(g.login, g.permission) FROM document_grants g WHERE g.doc_id = d.id), '{}'),
+			d.file, $2
+		FROM documents d WHERE d.id = $1
+		ON CONFLICT (doc_id, version) DO NOTHING`
+	if _, err := db.ExecContext(ctx, query, id, login); err != nil {
+		return fmt.Errorf("ошибка при сохранении версии: %w", err)
+	}
+
+	// Оставляем только последние версии
+	retention := config.VersionRetention()
+	if retention == 0 {
+		return nil
+	}
+	query = `DELETE FROM document_versions WHERE doc_id = $1 AND version NOT IN (
+			SELECT version FROM document_versions WHERE doc_id = $1 ORDER BY version DESC LIMIT $2)`
+	if _, err := db.ExecContext(ctx, query, id, retention); err != nil {
+		return fmt.Errorf("ошибка при удалении старых версий: %w", err)
+	}
+
+	return nil
+}
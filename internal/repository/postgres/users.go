@@ -0,0 +1,340 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/repository"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// uniqueViolation код ошибки PostgreSQL при нарушении уникальности
+const uniqueViolation = "23505"
+
+// Users хранилище учетных записей в PostgreSQL
+type Users struct {
+	db *sql.DB
+}
+
+// NewUsers создает Users
+func NewUsers(db *sql.DB) *Users {
+	return &Users{db: db}
+}
+
+// Create добавляет пользователя
+func (u *Users) Create(ctx context.Context, login, passwordHash, role, email string) error {
+	return createUser(ctx, u.db, login, passwordHash, role, email)
+}
+
+// createUser добавляет пользователя в рамках db
+func createUser(ctx context.Context, db queryer, login, passwordHash, role, email string) error {
+	var id int
+	query := `INSERT INTO users (login, password, role, email) VALUES ($1, $2, $3, NULLIF($4, ''))
+		ON CONFLICT DO NOTHING RETURNING id`
+	err := db.QueryRowContext(ctx, query, login, passwordHash, role, email).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.ErrExists
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка при создании пользователя: %w", err)
+	}
+	return nil
+}
+
+// Get возвращает учетную запись
+func (u *Users) Get(ctx context.Context, login string) (repository.Account, error) {
+	account := repository.Account{Login: login}
+	query := `SELECT password, role, COALESCE(email, ''), disabled, must_reset_password FROM users WHERE login = $1`
+	err := u.db.QueryRowContext(ctx, query, login).Scan(&account.PasswordHash, &account.Role, &account.Email, &account.Disabled, &account.MustReset)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.Account{}, repository.ErrNotFound
+	}
+	if err != nil {
+		return repository.Account{}, fmt.Errorf("ошибка при чтении пользователя: %w", err)
+	}
+	return account, nil
+}
+
+// Exists сообщает, есть ли пользователь с таким логином
+func (u *Users) Exists(ctx context.Context, login string) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM users WHERE login = $1)`
+	if err := u.db.QueryRowContext(ctx, query, login).Scan(&exists); err != nil {
+		return false, fmt.Errorf("ошибка при чтении пользователя: %w", err)
+	}
+	return exists, nil
+}
+
+// FindByEmail возвращает логин пользователя с email без учета регистра
+func (u *Users) FindByEmail(ctx context.Context, email string) (string, error) {
+	return findLogin(ctx, u.db, `SELECT login FROM users WHERE lower(email) = lower($1)`, email)
+}
+
+// findLogin выполняет запрос, возвращающий логин, ErrNotFound — строки нет
+func findLogin(ctx context.Context, db queryer, query string, args ...interface{}) (string, error) {
+	var login string
+	err := db.QueryRowContext(ctx, query, args...).Scan(&login)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", repository.ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка при поиске пользователя: %w", err)
+	}
+	return login, nil
+}
+
+// AdminExists сообщает, есть ли хотя бы один администратор
+func (u *Users) AdminExists(ctx context.Context) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM users WHERE role = $1)`
+	if err := u.db.QueryRowContext(ctx, query, models.RoleAdmin).Scan(&exists); err != nil {
+		return false, fmt.Errorf("ошибка при поиске администраторов: %w", err)
+	}
+	return exists, nil
+}
+
+// List возвращает пользователей со статистикой использования, документы в корзине считаются отдельно
+func (u *Users) List(ctx context.Context) ([]models.UserInfo, error) {
+	query := `SELECT u.login, u.role, COALESCE(u.email, ''), u.disabled, u.must_reset_password, COALESCE(u.created::text, ''),
+			(SELECT COUNT(*) FROM documents d WHERE d.owner = u.login AND d.deleted_at IS NULL),
+			(SELECT COALESCE(SUM(octet_length(d.file)), 0) FROM documents d WHERE d.owner = u.login AND d.deleted_at IS NULL),
+			(SELECT COALESCE(SUM(octet_length(d.file)), 0) FROM documents d WHERE d.owner = u.login AND d.deleted_at IS NOT NULL),
+			(SELECT COUNT(*) FROM sessions s WHERE s.login = u.login AND s.revoked_at IS NULL)
+		FROM users u ORDER BY u.login`
+	rows, err := u.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при чтении пользователей: %w", err)
+	}
+	defer rows.Close()
+
+	users := []models.UserInfo{}
+	for rows.Next() {
+		var info models.UserInfo
+		if err := rows.Scan(&info.Login, &info.Role, &info.Email, &info.Disabled, &info.MustReset, &info.Created, &info.Documents, &info.Bytes, &info.TrashBytes, &info.Sessions); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении пользователей: %w", err)
+		}
+		users = append(users, info)
+	}
+	return users, rows.Err()
+}
+
+// SetPassword сохраняет новый хэш пароля и снимает требование смены пароля
+func (u *Users) SetPassword(ctx context.Context, login, passwordHash string) error {
+	return setPassword(ctx, u.db, login, passwordHash)
+}
+
+// setPassword сохраняет хэш пароля в рамках db
+func setPassword(ctx context.Context, db queryer, login, passwordHash string) error {
+	query := `UPDATE users SET password = $2, must_reset_password = FALSE WHERE login = $1`
+	if err := execOne(ctx, db, query, login, passwordHash); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("ошибка при смене пароля: %w", err)
+	}
+	return nil
+}
+
+// SetEmail задает email пользователя, пустой email удаляет его
+func (u *Users) SetEmail(ctx context.Context, login, email string) error {
+	err := execOne(ctx, u.db, `UPDATE users SET email = NULLIF($2, '') WHERE login = $1`, login, email)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return repository.ErrExists
+	}
+	return err
+}
+
+// SetDisabled отключает или включает учетную запись
+func (u *Users) SetDisabled(ctx context.Context, login string, disabled bool) error {
+	return execOne(ctx, u.db, `UPDATE users SET disabled = $2 WHERE login = $1`, login, disabled)
+}
+
+// RequireReset требует от пользователя сменить пароль
+func (u *Users) RequireReset(ctx context.Context, login string) error {
+	return execOne(ctx, u.db, `UPDATE users SET must_reset_password = TRUE WHERE login = $1`, login)
+}
+
+// IssueResetToken сохраняет хэш токена сброса пароля
+func (u *Users) IssueResetToken(ctx context.Context, login, tokenHash, issuedBy string, ttl time.Duration) error {
+	return inTx(ctx, u.db, func(tx *sql.Tx) error {
+		// Помечаем пользователя и делаем недействительными прежние токены сброса
+		if err := execOne(ctx, tx, `UPDATE users SET must_reset_password = TRUE WHERE login = $1`, login); err != nil {
+			return err
+		}
+
+		queries := []struct {
+			query string
+			args  []interface{}
+		}{
+			{`UPDATE password_resets SET used_at = NOW() WHERE login = $1 AND used_at IS NULL`, []interface{}{login}},
+			{`INSERT INTO password_resets (login, token_hash, issued_by, expires_at)
+				VALUES ($1, $2, $3, NOW() + make_interval(secs => $4))`,
+				[]interface{}{login, tokenHash, issuedBy, ttl.Seconds()}},
+		}
+		for _, q := range queries {
+			if _, err := tx.ExecContext(ctx, q.query, q.args...); err != nil {
+				return fmt.Errorf("ошибка при выпуске токена сброса: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// ResetPassword гасит токен сброса и сохраняет новый хэш пароля
+func (u *Users) ResetPassword(ctx context.Context, login, tokenHash, passwordHash string) error {
+	return inTx(ctx, u.db, func(tx *sql.Tx) error {
+		// Гасим токен, одновременно проверяя срок действия и владельца
+		var id int
+		query := `UPDATE password_resets SET used_at = NOW()
+			WHERE token_hash = $1 AND login = $2 AND used_at IS NULL AND expires_at > NOW() RETURNING id`
+		err := tx.QueryRowContext(ctx, query, tokenHash, login).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return repository.ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка при проверке токена сброса: %w", err)
+		}
+
+		return setPassword(ctx, tx, login, passwordHash)
+	})
+}
+
+// FindByIdentity возвращает логин, привязанный к пользователю IdP
+func (u *Users) FindByIdentity(ctx context.Context, issuer, subject string) (string, error) {
+	return findLogin(ctx, u.db, `SELECT login FROM user_identities WHERE issuer = $1 AND subject = $2`, issuer, subject)
+}
+
+// LinkIdentity привязывает пользователя IdP к учетной записи
+func (u *Users) LinkIdentity(ctx context.Context, issuer, subject, login string) error {
+	return linkIdentity(ctx, u.db, issuer, subject, login)
+}
+
+// linkIdentity сохраняет привязку в рамках db
+func linkIdentity(ctx context.Context, db queryer, issuer, subject, login string) error {
+	query := `INSERT INTO user_identities (issuer, subject, login) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+	if _, err := db.ExecContext(ctx, query, issuer, subject, login); err != nil {
+		return fmt.Errorf("ошибка при сохранении привязки: %w", err)
+	}
+	return nil
+}
+
+// CreateOIDC создает учетную запись пользователя IdP вместе с привязкой
+func (u *Users) CreateOIDC(ctx context.Context, login, passwordHash, email, issuer, subject string) error {
+	return inTx(ctx, u.db, func(tx *sql.Tx) error {
+		if err := createUser(ctx, tx, login, passwordHash, models.RoleUser, email); err != nil {
+			return err
+		}
+		return linkIdentity(ctx, tx, issuer, subject, login)
+	})
+}
+
+// Certificates возвращает клиентские сертификаты пользователя
+func (u *Users) Certificates(ctx context.Context, login string) ([]models.ClientCertificate, error) {
+	query := `SELECT issuer, subject FROM client_certificates WHERE login = $1 ORDER BY issuer, subject`
+	rows, err := u.db.QueryContext(ctx, query, login)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при чтении сертификатов: %w", err)
+	}
+	defer rows.Close()
+
+	certificates := []models.ClientCertificate{}
+	for rows.Next() {
+		var cert models.ClientCertificate
+		if err := rows.Scan(&cert.Issuer, &cert.Subject); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении сертификатов: %w", err)
+		}
+		certificates = append(certificates, cert)
+	}
+	return certificates, rows.Err()
+}
+
+// FindByCertificate возвращает логин, которому привязан сертификат
+func (u *Users) FindByCertificate(ctx context.Context, cert models.ClientCertificate) (string, error) {
+	query := `SELECT login FROM client_certificates WHERE issuer = $1 AND subject = $2`
+	return findLogin(ctx, u.db, query, cert.Issuer, cert.Subject)
+}
+
+// AddCertificate привязывает клиентский сертификат к пользователю
+func (u *Users) AddCertificate(ctx context.Context, login string, cert models.ClientCertificate) error {
+	exists, err := u.Exists(ctx, login)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return repository.ErrNotFound
+	}
+
+	query := `INSERT INTO client_certificates (issuer, subject, login) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+	err = execOne(ctx, u.db, query, cert.Issuer, cert.Subject, login)
+	if errors.Is(err, repository.ErrNotFound) {
+		return repository.ErrExists
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка при привязке сертификата: %w", err)
+	}
+	return nil
+}
+
+// RemoveCertificate отвязывает сертификат от пользователя
+func (u *Users) RemoveCertificate(ctx context.Context, login string, cert models.ClientCertificate) error {
+	query := `DELETE FROM client_certificates WHERE login = $1 AND issuer = $2 AND subject = $3`
+	err := execOne(ctx, u.db, query, login, cert.Issuer, cert.Subject)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("ошибка при отвязке сертификата: %w", err)
+	}
+	return err
+}
+
+// Delete удаляет пользователя и его документы или передает документы reassignTo
+func (u *Users) Delete(ctx context.Context, login, reassignTo string) error {
+	return inTx(ctx, u.db, func(tx *sql.Tx) error {
+		// Блокируем пользователя, чтобы он не загрузил документы во время удаления
+		var exists bool
+		err := tx.QueryRowContext(ctx, `SELECT TRUE FROM users WHERE login = $1 FOR UPDATE`, login).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			return repository.ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка при чтении пользователя: %w", err)
+		}
+
+		// Документы удаляются мимо корзины: в ней они остались бы за логином,
+		// который может зарегистрировать другой пользователь
+		queries := []string{`DELETE FROM documents WHERE owner = $1`}
+		args := [][]interface{}{{login}}
+		if reassignTo != "" {
+			err = tx.QueryRowContext(ctx, `SELECT TRUE FROM users WHERE login = $1`, reassignTo).Scan(&exists)
+			if errors.Is(err, sql.ErrNoRows) {
+				return repository.ErrUnknownTarget
+			}
+			if err != nil {
+				return fmt.Errorf("ошибка при чтении пользователя: %w", err)
+			}
+
+			// Новый владелец не должен оставаться в grant своих же документов
+			queries = []string{
+				`UPDATE documents SET owner = $2 WHERE owner = $1`,
+				`DELETE FROM document_grants g USING documents d WHERE g.doc_id = d.id AND d.owner = $1 AND g.login = $1`,
+			}
+			args = [][]interface{}{{login, reassignTo}, {reassignTo}}
+		}
+		queries = append(queries,
+			`DELETE FROM document_grants WHERE login = $1`,
+			`DELETE FROM users WHERE login = $1`,
+		)
+		args = append(args, []interface{}{login}, []interface{}{login})
+
+		for i, query := range queries {
+			if _, err := tx.ExecContext(ctx, query, args[i]...); err != nil {
+				return fmt.Errorf("ошибка при удалении пользователя: %w", err)
+			}
+		}
+		return nil
+	})
+}
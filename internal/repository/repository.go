@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cache-web-server/internal/models"
+)
+
+// Ошибки репозиториев, одинаковые для всех реализаций
+var (
+	// ErrNotFound запись не найдена
+	ErrNotFound = errors.New("запись не найдена")
+	// ErrExists запись с таким ключом уже существует
+	ErrExists = errors.New("запись уже существует")
+	// ErrExpired срок хранения документа истек
+	ErrExpired = errors.New("срок хранения документа истек")
+	// ErrTrashed документ находится в корзине
+	ErrTrashed = errors.New("документ находится в корзине")
+	// ErrVersionConflict версия документа не совпала с ожидаемой
+	ErrVersionConflict = errors.New("версия документа изменилась")
+	// ErrUnknownGroup доступ выдается несуществующей группе
+	ErrUnknownGroup = errors.New("группа не найдена")
+	// ErrUnknownTarget пользователь, которому передаются документы, не найден
+	ErrUnknownTarget = errors.New("новый владелец не найден")
+)
+
+// AnyVersion вместо ожидаемой версии документа отключает ее проверку (If-Match: *)
+const AnyVersion = -1
+
+// NewDocument загружаемый документ
+type NewDocument struct {
+	ID      string
+	Name    string
+	Mime    string
+	File    bool
+	Public  bool
+	Owner   string
+	Content []byte
+	Expires *time.Time
+	Access  map[string]models.Permission
+}
+
+// DocumentFilter условия выборки списка документов
+type DocumentFilter struct {
+	// Owner владелец документов
+	Owner string
+	// Viewer пользователь, для которого строится список. Если он не владелец,
+	// возвращаются только публичные документы и документы, выданные ему лично или через группы.
+	Viewer string
+	// Field и Value фильтр по полю: name, mime, file или public
+	Field string
+	Value string
+	// Limit ограничение количества, 0 — без ограничения
+	Limit int
+}
+
+// FilterFields поля, по которым разрешена фильтрация списка документов
+var FilterFields = []string{"name", "mime", "file", "public"}
+
+// DocumentRepository хранилище документов, их прав доступа и версий.
+// Документы в корзине и с истекшим сроком хранения считаются отсутствующими,
+// если метод не работает с корзиной явно.
+type DocumentRepository interface {
+	// Access возвращает уровень доступа пользователя к активному (trashed = false)
+	// или удаленному в корзину (trashed = true) документу.
+	// ErrNotFound — документа нет, ErrExpired — истек срок хранения.
+	Access(ctx context.Context, id, login string, trashed bool) (models.Permission, error)
+	// Create сохраняет документ, его права доступа и первую версию.
+	// ErrExists — документ с таким идентификатором уже есть, ErrTrashed — он в корзине,
+	// ErrExpired — срок его хранения истек, но он еще не удален.
+	Create(ctx context.Context, doc NewDocument) error
+	// List возвращает документы с правами доступа, упорядоченные по имени и дате создания
+	List(ctx context.Context, filter DocumentFilter) ([]models.Document, error)
+	// Get возвращает активный документ с правами доступа и его содержимое.
+	// ErrNotFound — документа нет, он в корзине или истек срок его хранения.
+	Get(ctx context.Context, id string) (models.Document, []byte, error)
+	// UpdateContent заменяет содержимое документа и возвращает новую версию.
+	// Пустой mime оставляет прежний тип содержимого.
+	UpdateContent(ctx context.Context, id string, version int, content []byte, mime, author string) (int, error)
+	// UpdateMeta изменяет метаданные и права доступа документа функцией update
+	// и возвращает новую версию. Ошибка update возвращается без изменений.
+	UpdateMeta(ctx context.Context, id string, version int, author string, update func(doc *models.Document) error) (int, error)
+	// Trash перемещает документ в корзину
+	Trash(ctx context.Context, id, login string) error
+	// ListTrash возвращает документы в корзине владельца, сначала удаленные последними
+	ListTrash(ctx context.Context, owner string) ([]models.Document, error)
+	// Untrash возвращает документ из корзины
+	Untrash(ctx context.Context, id string) error
+	// Purge окончательно удаляет документ из корзины
+	Purge(ctx context.Context, id string) error
+	// Versions возвращает историю версий документа, начиная с последней
+	Versions(ctx context.Context, id string) ([]models.Version, error)
+	// GetVersion возвращает версию документа и ее содержимое
+	GetVersion(ctx context.Context, id string, version int) (models.Version, []byte, error)
+	// RestoreVersion восстанавливает содержимое и метаданные документа из версии
+	// и возвращает новую версию. Права доступа не меняются.
+	RestoreVersion(ctx context.Context, id string, version, expected int, author string) (int, error)
+}
+
+// Account учетная запись пользователя
+type Account struct {
+	Login        string
+	PasswordHash string
+	Role         string
+	Email        string
+	Disabled     bool
+	MustReset    bool
+}
+
+// UserRepository хранилище учетных записей пользователей
+type UserRepository interface {
+	// Create добавляет пользователя, email может быть пустым. ErrExists — логин или email заняты.
+	Create(ctx context.Context, login, passwordHash, role, email string) error
+	// Get возвращает учетную запись, ErrNotFound — пользователя нет
+	Get(ctx context.Context, login string) (Account, error)
+	// Exists сообщает, есть ли пользователь с таким логином
+	Exists(ctx context.Context, login string) (bool, error)
+	// FindByEmail возвращает логин пользователя с email без учета регистра, ErrNotFound — такого нет
+	FindByEmail(ctx context.Context, email string) (string, error)
+	// AdminExists сообщает, есть ли хотя бы один администратор
+	AdminExists(ctx context.Context) (bool, error)
+	// List возвращает пользователей со статистикой использования, упорядоченных по логину
+	List(ctx context.Context) ([]models.UserInfo, error)
+	// SetPassword сохраняет новый хэш пароля и снимает требование смены пароля
+	SetPassword(ctx context.Context, login, passwordHash string) error
+	// SetEmail задает email, по которому учетная запись связывается с пользователем IdP.
+	// Пустой email удаляет его. ErrExists — email занят другим пользователем.
+	SetEmail(ctx context.Context, login, email string) error
+	// SetDisabled отключает или включает учетную запись
+	SetDisabled(ctx context.Context, login string, disabled bool) error
+	// RequireReset требует от пользователя сменить пароль
+	RequireReset(ctx context.Context, login string) error
+	// IssueResetToken требует смены пароля и сохраняет хэш одноразового токена сброса,
+	// прежние токены пользователя становятся недействительными
+	IssueResetToken(ctx context.Context, login, tokenHash, issuedBy string, ttl time.Duration) error
+	// ResetPassword гасит токен сброса и сохраняет новый хэш пароля.
+	// ErrNotFound — токен неверный, использован или просрочен.
+	ResetPassword(ctx context.Context, login, tokenHash, passwordHash string) error
+	// FindByIdentity возвращает логин, привязанный к пользователю IdP, ErrNotFound — привязки нет
+	FindByIdentity(ctx context.Context, issuer, subject string) (string, error)
+	// LinkIdentity привязывает пользователя IdP к учетной записи, существующая привязка не меняется
+	LinkIdentity(ctx context.Context, issuer, subject, login string) error
+	// CreateOIDC создает учетную запись пользователя IdP с ролью user и привязывает ее к нему.
+	// email может быть пустым. ErrExists — логин или email заняты.
+	CreateOIDC(ctx context.Context, login, passwordHash, email, issuer, subject string) error
+	// Certificates возвращает клиентские сертификаты пользователя, упорядоченные по издателю и субъекту
+	Certificates(ctx context.Context, login string) ([]models.ClientCertificate, error)
+	// FindByCertificate возвращает логин, которому привязан сертификат, ErrNotFound — привязки нет
+	FindByCertificate(ctx context.Context, cert models.ClientCertificate) (string, error)
+	// AddCertificate привязывает клиентский сертификат к пользователю.
+	// ErrNotFound — пользователя нет, ErrExists — сертификат уже привязан.
+	AddCertificate(ctx context.Context, login string, cert models.ClientCertificate) error
+	// RemoveCertificate отвязывает сертификат от пользователя, ErrNotFound — привязки нет
+	RemoveCertificate(ctx context.Context, login string, cert models.ClientCertificate) error
+	// Delete удаляет пользователя. Если reassignTo пуст, его документы удаляются
+	// окончательно вместе с версиями, минуя корзину, иначе передаются
+	// пользователю reassignTo (ErrUnknownTarget, если его нет).
+	Delete(ctx context.Context, login, reassignTo string) error
+}
@@ -0,0 +1,86 @@
+package sessions
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrRefreshReused повторное использование уже обменянного refresh-токена.
+// Это признак кражи токена, поэтому вся сессия отзывается.
+var ErrRefreshReused = errors.New("повторное использование refresh-токена")
+
+// SaveRefresh сохраняет хэш refresh-токена сессии
+func (s *Store) SaveRefresh(ctx context.Context, sessionID, refresh string, ttl time.Duration) error {
+	return saveRefresh(ctx, s.db, sessionID, refresh, ttl)
+}
+
+// Rotate обменивает refresh-токен на новый в той же сессии.
+// Возвращает сессию и логин пользователя.
+func (s *Store) Rotate(ctx context.Context, refresh, next string, ttl time.Duration) (string, string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("ошибка при обмене refresh-токена: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	var sessionID, login string
+	var used, expired, revoked bool
+	query := `SELECT r.id, r.session_id, s.login, r.used_at IS NOT NULL, r.expires_at <= NOW(), s.revoked_at IS NOT NULL
+		FROM refresh_tokens r JOIN sessions s ON s.id = r.session_id
+		WHERE r.token_hash = $1 FOR UPDATE OF r`
+	err = tx.QueryRowContext(ctx, query, HashToken(refresh)).Scan(&id, &sessionID, &login, &used, &expired, &revoked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", ErrNotFound
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("ошибка при обмене refresh-токена: %w", err)
+	}
+
+	// Токен уже обменивали — отзываем всю сессию
+	if used {
+		if _, err := tx.ExecContext(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`, sessionID); err != nil {
+			return "", "", fmt.Errorf("ошибка при отзыве сессии: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return "", "", fmt.Errorf("ошибка при отзыве сессии: %w", err)
+		}
+		s.remember(sessionID, login, false)
+		return "", "", ErrRefreshReused
+	}
+
+	if expired || revoked {
+		return "", "", ErrNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1`, id); err != nil {
+		return "", "", fmt.Errorf("ошибка при обмене refresh-токена: %w", err)
+	}
+	if err := saveRefresh(ctx, tx, sessionID, next, ttl); err != nil {
+		return "", "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", "", fmt.Errorf("ошибка при обмене refresh-токена: %w", err)
+	}
+
+	return sessionID, login, nil
+}
+
+// execer общий интерфейс для *sql.DB и *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// saveRefresh сохраняет хэш refresh-токена
+func saveRefresh(ctx context.Context, db execer, sessionID, refresh string, ttl time.Duration) error {
+	query := `INSERT INTO refresh_tokens (session_id, token_hash, expires_at)
+		VALUES ($1, $2, NOW() + make_interval(secs => $3))`
+	if _, err := db.ExecContext(ctx, query, sessionID, HashToken(refresh), ttl.Seconds()); err != nil {
+		return fmt.Errorf("ошибка при сохранении refresh-токена: %w", err)
+	}
+	return nil
+}
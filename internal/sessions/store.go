@@ -0,0 +1,241 @@
+package sessions
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cache-web-server/internal/tracing"
+)
+
+// ErrNotFound сессия не найдена или принадлежит другому пользователю
+var ErrNotFound = errors.New("сессия не найдена")
+
+// Session модель сессии пользователя
+type Session struct {
+	ID        string `json:"id"`
+	Login     string `json:"login"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Created   string `json:"created"`
+	LastSeen  string `json:"last_seen"`
+}
+
+// maxCacheSize размер кэша, после которого из него удаляются устаревшие записи
+const maxCacheSize = 10000
+
+// cacheEntry запись кэша проверок сессий
+type cacheEntry struct {
+	login   string
+	active  bool
+	expires time.Time
+}
+
+// Store хранилище сессий в БД с кэшем в памяти.
+// Результаты проверок кэшируются на cacheTTL, отзыв через Store сразу попадает в кэш.
+type Store struct {
+	db       *sql.DB
+	cacheTTL time.Duration
+
+	mu     sync.RWMutex
+	cache  map[string]cacheEntry
+	warmed atomic.Bool
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// NewStore создает хранилище сессий
+func NewStore(db *sql.DB, cacheTTL time.Duration) *Store {
+	return &Store{
+		db:       db,
+		cacheTTL: cacheTTL,
+		cache:    make(map[string]cacheEntry),
+	}
+}
+
+// NewID генерирует случайный идентификатор сессии
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("ошибка при генерации идентификатора сессии: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HashToken возвращает хэш токена для хранения в БД
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create сохраняет новую сессию
+func (s *Store) Create(ctx context.Context, id, login, ip, userAgent string) error {
+	query := `INSERT INTO sessions (id, login, ip, user_agent) VALUES ($1, $2, $3, $4)`
+	if _, err := s.db.ExecContext(ctx, query, id, login, ip, userAgent); err != nil {
+		return fmt.Errorf("ошибка при создании сессии: %w", err)
+	}
+	return nil
+}
+
+// Active проверяет, что сессия существует, не отозвана и принадлежит login
+func (s *Store) Active(ctx context.Context, id, login string) (bool, error) {
+	ctx, span := tracing.StartChild(ctx, "sessions.cache", tracing.KindInternal)
+	defer span.End()
+
+	s.mu.RLock()
+	entry, ok := s.cache[id]
+	s.mu.RUnlock()
+	if ok && time.Now().Before(entry.expires) {
+		s.hits.Add(1)
+		span.SetAttr("cache.hit", true)
+		return entry.active && entry.login == login, nil
+	}
+	s.misses.Add(1)
+	span.SetAttr("cache.hit", false)
+
+	var owner string
+	var revoked bool
+	query := `UPDATE sessions SET last_seen = NOW() WHERE id = $1 RETURNING login, revoked_at IS NOT NULL`
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&owner, &revoked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ошибка при проверке сессии: %w", err)
+	}
+
+	s.remember(id, owner, !revoked)
+	return !revoked && owner == login, nil
+}
+
+// Revoke отзывает сессию пользователя
+func (s *Store) Revoke(ctx context.Context, id, login string) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND login = $2 AND revoked_at IS NULL`
+	res, err := s.db.ExecContext(ctx, query, id, login)
+	if err != nil {
+		return fmt.Errorf("ошибка при отзыве сессии: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	s.remember(id, login, false)
+	return nil
+}
+
+// RevokeAll отзывает все сессии пользователя, кроме except (если задана)
+func (s *Store) RevokeAll(ctx context.Context, login, except string) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE login = $1 AND id <> $2 AND revoked_at IS NULL RETURNING id`
+	rows, err := s.db.QueryContext(ctx, query, login, except)
+	if err != nil {
+		return fmt.Errorf("ошибка при отзыве сессий: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("ошибка при отзыве сессий: %w", err)
+		}
+		s.remember(id, login, false)
+	}
+
+	return rows.Err()
+}
+
+// List возвращает активные сессии пользователя
+func (s *Store) List(ctx context.Context, login string) ([]Session, error) {
+	query := `SELECT id, login, COALESCE(ip, ''), COALESCE(user_agent, ''), created, last_seen
+		FROM sessions WHERE login = $1 AND revoked_at IS NULL ORDER BY last_seen DESC`
+	rows, err := s.db.QueryContext(ctx, query, login)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при чтении сессий: %w", err)
+	}
+	defer rows.Close()
+
+	list := []Session{}
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(&session.ID, &session.Login, &session.IP, &session.UserAgent, &session.Created, &session.LastSeen); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении сессий: %w", err)
+		}
+		list = append(list, session)
+	}
+
+	return list, rows.Err()
+}
+
+// Warm заполняет кэш сессиями, использованными за последние since,
+// чтобы после запуска первые запросы не упирались в БД
+func (s *Store) Warm(ctx context.Context, since time.Duration) error {
+	query := `SELECT id, login FROM sessions
+		WHERE revoked_at IS NULL AND last_seen > NOW() - make_interval(secs => $1)
+		ORDER BY last_seen DESC LIMIT $2`
+	rows, err := s.db.QueryContext(ctx, query, since.Seconds(), maxCacheSize)
+	if err != nil {
+		return fmt.Errorf("ошибка при загрузке сессий в кэш: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, login string
+		if err := rows.Scan(&id, &login); err != nil {
+			return fmt.Errorf("ошибка при загрузке сессий в кэш: %w", err)
+		}
+		s.remember(id, login, true)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка при загрузке сессий в кэш: %w", err)
+	}
+
+	s.warmed.Store(true)
+	return nil
+}
+
+// CheckWarm возвращает ошибку, пока кэш не заполнен
+func (s *Store) CheckWarm(ctx context.Context) error {
+	if !s.warmed.Load() {
+		return errors.New("кэш сессий не заполнен")
+	}
+	return nil
+}
+
+// CacheStats возвращает число попаданий и промахов кэша проверок сессий
+func (s *Store) CacheStats() (hits, misses uint64) {
+	return s.hits.Load(), s.misses.Load()
+}
+
+// CountActive возвращает число неотозванных сессий, использованных за последние since
+func (s *Store) CountActive(ctx context.Context, since time.Duration) (int, error) {
+	var n int
+	query := `SELECT COUNT(*) FROM sessions WHERE revoked_at IS NULL AND last_seen > NOW() - make_interval(secs => $1)`
+	if err := s.db.QueryRowContext(ctx, query, since.Seconds()).Scan(&n); err != nil {
+		return 0, fmt.Errorf("ошибка при подсчете сессий: %w", err)
+	}
+	return n, nil
+}
+
+// remember кладет результат проверки сессии в кэш
+func (s *Store) remember(id, login string, active bool) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Периодически вычищаем устаревшие записи, чтобы кэш не рос бесконечно
+	if len(s.cache) >= maxCacheSize {
+		for key, e := range s.cache {
+			if !now.Before(e.expires) {
+				delete(s.cache, key)
+			}
+		}
+	}
+	s.cache[id] = cacheEntry{login: login, active: active, expires: now.Add(s.cacheTTL)}
+}
@@ -0,0 +1,293 @@
+package tokens
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWKSMaxAge время, на которое сторонние сервисы могут кэшировать JWKS.
+// Ключ, созданный ротацией, публикуется за это время до начала действия,
+// чтобы подписанные им токены проверялись и по закэшированному набору.
+const JWKSMaxAge = 5 * time.Minute
+
+// ringKey ключ из каталога вместе с моментом начала его действия
+type ringKey struct {
+	*Key
+	activated time.Time
+}
+
+// KeyRing набор асимметричных ключей (RS256 или EdDSA), загружаемых из каталога.
+// Каждый файл <kid>.pem содержит закрытый ключ в PKCS#8 (RSA также в PKCS#1),
+// момент начала действия ключа — время изменения файла.
+// Подписывает самый новый уже действующий ключ, будущие ключи уже публикуются,
+// предыдущие остаются доступными для проверки еще overlap после смены.
+type KeyRing struct {
+	dir     string
+	alg     string
+	overlap time.Duration
+
+	mu   sync.RWMutex
+	keys []ringKey
+}
+
+// NewKeyRing загружает ключи из каталога. Если каталог пуст, генерирует первый ключ алгоритмом alg.
+func NewKeyRing(dir, alg string, overlap time.Duration) (*KeyRing, error) {
+	if alg != jwt.SigningMethodRS256.Alg() && alg != jwt.SigningMethodEdDSA.Alg() {
+		return nil, fmt.Errorf("неподдерживаемый алгоритм ключей: %s", alg)
+	}
+
+	ring := &KeyRing{dir: dir, alg: alg, overlap: overlap}
+	if err := ring.Reload(); err != nil {
+		return nil, err
+	}
+
+	// Первый ключ еще никто не закэшировал, поэтому он действует сразу
+	if _, err := ring.SigningKey(); err != nil {
+		if err := ring.Rotate(0); err != nil {
+			return nil, err
+		}
+	}
+
+	return ring, nil
+}
+
+// Reload перечитывает ключи из каталога
+func (k *KeyRing) Reload() error {
+	files, err := filepath.Glob(filepath.Join(k.dir, "*.pem"))
+	if err != nil {
+		return fmt.Errorf("ошибка при чтении каталога ключей: %w", err)
+	}
+
+	keys := make([]ringKey, 0, len(files))
+	for _, file := range files {
+		key, err := loadKey(file)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].activated.Before(keys[j].activated)
+	})
+
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+	return nil
+}
+
+// Rotate генерирует новый ключ, который становится ключом подписи через activateIn.
+// До этого ключ только публикуется.
+func (k *KeyRing) Rotate(activateIn time.Duration) error {
+	var private crypto.Signer
+	var err error
+	if k.alg == jwt.SigningMethodEdDSA.Alg() {
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	} else {
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка при генерации ключа: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return fmt.Errorf("ошибка при сериализации ключа: %w", err)
+	}
+
+	if err := os.MkdirAll(k.dir, 0o700); err != nil {
+		return fmt.Errorf("ошибка при создании каталога ключей: %w", err)
+	}
+
+	// Пишем во временный файл и переименовываем, чтобы не прочитать ключ наполовину
+	suffix, err := randomString(4)
+	if err != nil {
+		return err
+	}
+	kid := time.Now().UTC().Format("20060102T150405Z") + "-" + suffix
+	tmp := filepath.Join(k.dir, "."+kid+".tmp")
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("ошибка при сохранении ключа: %w", err)
+	}
+	// Момент начала действия ключа — время изменения файла
+	activated := time.Now().Add(activateIn)
+	if err := os.Chtimes(tmp, activated, activated); err != nil {
+		return fmt.Errorf("ошибка при сохранении ключа: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(k.dir, kid+".pem")); err != nil {
+		return fmt.Errorf("ошибка при сохранении ключа: %w", err)
+	}
+
+	slog.Info("сгенерирован новый ключ подписи", "kid", kid, "activated", activated)
+	return k.Reload()
+}
+
+// Start периодически перечитывает каталог ключей и, если rotateEvery > 0,
+// генерирует новый ключ, когда текущий старше rotateEvery. Новый ключ начинает
+// действовать через JWKSMaxAge, пока он ждет, следующий не генерируется.
+// Останавливается при отмене ctx.
+// Возвращает канал, который закрывается после остановки.
+func (k *KeyRing) Start(ctx context.Context, reloadEvery, rotateEvery time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(reloadEvery)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if err := k.Reload(); err != nil {
+				slog.Error("ошибка при перечитывании ключей", "error", err)
+				continue
+			}
+
+			if rotateEvery > 0 && k.activeAge() >= rotateEvery && !k.pending() {
+				if err := k.Rotate(JWKSMaxAge); err != nil {
+					slog.Error("ошибка при ротации ключей", "error", err)
+				}
+			}
+		}
+	}()
+	return done
+}
+
+// activeAge возвращает возраст текущего ключа подписи
+func (k *KeyRing) activeAge() time.Duration {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if active := k.activeIndex(time.Now()); active >= 0 {
+		return time.Since(k.keys[active].activated)
+	}
+	return 0
+}
+
+// pending сообщает, есть ли опубликованный ключ, который еще не начал действовать
+func (k *KeyRing) pending() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return len(k.keys) > 0 && k.keys[len(k.keys)-1].activated.After(time.Now())
+}
+
+// activeIndex индекс текущего ключа подписи, -1 если действующих ключей нет
+func (k *KeyRing) activeIndex(now time.Time) int {
+	active := -1
+	for i, key := range k.keys {
+		if !key.activated.After(now) {
+			active = i
+		}
+	}
+	return active
+}
+
+// published ключи, которые можно использовать для проверки:
+// текущий, будущие и предыдущие, смененные не раньше чем overlap назад
+func (k *KeyRing) published(now time.Time) []ringKey {
+	var keys []ringKey
+	for i, key := range k.keys {
+		if i+1 < len(k.keys) && !k.keys[i+1].activated.After(now) &&
+			now.Sub(k.keys[i+1].activated) > k.overlap {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// SigningKey возвращает текущий ключ подписи
+func (k *KeyRing) SigningKey() (*Key, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	active := k.activeIndex(time.Now())
+	if active < 0 {
+		return nil, fmt.Errorf("в каталоге %s нет действующих ключей", k.dir)
+	}
+	return k.keys[active].Key, nil
+}
+
+// VerificationKey возвращает опубликованный ключ по kid
+func (k *KeyRing) VerificationKey(kid string) (*Key, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, key := range k.published(time.Now()) {
+		if key.ID == kid {
+			return key.Key, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// Methods возвращает алгоритмы, допустимые при проверке токенов: оба поддерживаемых,
+// а не только alg, потому что в каталоге могут лежать ключи обоих типов
+func (k *KeyRing) Methods() []string {
+	return []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+}
+
+// loadKey читает закрытый ключ из PEM-файла
+func loadKey(file string) (ringKey, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return ringKey{}, fmt.Errorf("ошибка при чтении ключа %s: %w", file, err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return ringKey{}, fmt.Errorf("ошибка при чтении ключа %s: %w", file, err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return ringKey{}, fmt.Errorf("файл %s не содержит PEM", file)
+	}
+
+	var private interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return ringKey{}, fmt.Errorf("ошибка при разборе ключа %s: %w", file, err)
+	}
+
+	key := &Key{ID: strings.TrimSuffix(filepath.Base(file), ".pem"), Private: private}
+	switch p := private.(type) {
+	case *rsa.PrivateKey:
+		key.Method = jwt.SigningMethodRS256
+		key.Public = &p.PublicKey
+	case ed25519.PrivateKey:
+		key.Method = jwt.SigningMethodEdDSA
+		key.Public = p.Public()
+	default:
+		return ringKey{}, fmt.Errorf("неподдерживаемый тип ключа в %s", file)
+	}
+
+	return ringKey{Key: key, activated: info.ModTime()}, nil
+}
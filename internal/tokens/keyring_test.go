@@ -0,0 +1,54 @@
+package tokens
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestKeyRingRotatePublishesBeforeActivation(t *testing.T) {
+	ring, err := NewKeyRing(t.TempDir(), jwt.SigningMethodEdDSA.Alg(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := ring.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ring.Rotate(JWKSMaxAge); err != nil {
+		t.Fatal(err)
+	}
+	if !ring.pending() {
+		t.Fatal("новый ключ должен ждать начала действия")
+	}
+
+	// Пока новый ключ не действует, подписывает прежний, а в JWKS уже оба
+	signing, err := ring.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signing.ID != first.ID {
+		t.Fatalf("ключ подписи сменился до начала действия нового: %s", signing.ID)
+	}
+	if n := len(ring.JWKS().Keys); n != 2 {
+		t.Fatalf("в JWKS %d ключей, ожидалось 2", n)
+	}
+
+	// После JWKSMaxAge подписывает новый ключ, прежний еще проверяется
+	ring.mu.RLock()
+	next := ring.keys[len(ring.keys)-1]
+	published := ring.published(next.activated.Add(time.Second))
+	active := ring.keys[ring.activeIndex(next.activated.Add(time.Second))]
+	ring.mu.RUnlock()
+	if active.ID == first.ID {
+		t.Fatal("новый ключ не начал действовать")
+	}
+	if len(published) != 2 {
+		t.Fatalf("опубликовано %d ключей, ожидалось 2", len(published))
+	}
+	if d := next.activated.Sub(time.Now()); d < JWKSMaxAge-time.Minute {
+		t.Fatalf("ключ начнет действовать через %s, раньше срока кэша JWKS", d)
+	}
+}
@@ -0,0 +1,60 @@
+package tokens
+
+import (
+	"errors"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrUnknownKey ключ с таким kid не найден
+var ErrUnknownKey = errors.New("неизвестный ключ подписи")
+
+// KeySource источник ключей для подписи и проверки токенов
+type KeySource interface {
+	// SigningKey возвращает текущий ключ подписи
+	SigningKey() (*Key, error)
+	// VerificationKey возвращает ключ проверки по kid
+	VerificationKey(kid string) (*Key, error)
+	// Methods возвращает допустимые алгоритмы подписи
+	Methods() []string
+}
+
+// Key ключ подписи токенов
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private interface{}
+	Public  interface{}
+}
+
+// secretSource общий секрет HS256
+type secretSource struct {
+	key *Key
+}
+
+// NewSecretSource создает источник ключей на общем секрете HS256
+func NewSecretSource(secret string) KeySource {
+	return &secretSource{key: &Key{
+		Method:  jwt.SigningMethodHS256,
+		Private: []byte(secret),
+		Public:  []byte(secret),
+	}}
+}
+
+// SigningKey возвращает общий секрет
+func (s *secretSource) SigningKey() (*Key, error) {
+	return s.key, nil
+}
+
+// VerificationKey возвращает общий секрет, kid не используется
+func (s *secretSource) VerificationKey(kid string) (*Key, error) {
+	if kid != "" {
+		return nil, ErrUnknownKey
+	}
+	return s.key, nil
+}
+
+// Methods возвращает HS256
+func (s *secretSource) Methods() []string {
+	return []string{jwt.SigningMethodHS256.Alg()}
+}
@@ -0,0 +1,21 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+)
+
+// randomString генерирует случайную строку из n байт в base64url
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("ошибка при генерации случайной строки: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NewRefreshToken генерирует непрозрачный refresh-токен
+func NewRefreshToken() (string, error) {
+	return randomString(32)
+}
@@ -0,0 +1,111 @@
+package tokens
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// leeway допустимое расхождение часов при проверке времени в токене
+const leeway = 30 * time.Second
+
+// Claims утверждения access-токена
+type Claims struct {
+	Login     string `json:"login"`
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// Issuer выпускает и проверяет access-токены
+type Issuer struct {
+	keys   KeySource
+	issuer string
+	ttl    time.Duration
+}
+
+// NewIssuer создает Issuer, подписывающий токены ключами из keys
+func NewIssuer(keys KeySource, issuer string, ttl time.Duration) *Issuer {
+	return &Issuer{
+		keys:   keys,
+		issuer: issuer,
+		ttl:    ttl,
+	}
+}
+
+// TTL время жизни access-токена
+func (i *Issuer) TTL() time.Duration {
+	return i.ttl
+}
+
+// Issue выпускает access-токен для сессии пользователя
+func (i *Issuer) Issue(login, sessionID string) (string, error) {
+	jti, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := Claims{
+		Login:     login,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    i.issuer,
+			Subject:   login,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(i.ttl)),
+		},
+	}
+
+	key, err := i.keys.SigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	return token.SignedString(key.Private)
+}
+
+// Parse проверяет подпись, алгоритм и обязательные утверждения токена
+func (i *Issuer) Parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := i.keys.VerificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		// Алгоритм токена должен совпадать с алгоритмом ключа
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, errors.New("алгоритм токена не совпадает с алгоритмом ключа")
+		}
+		return key.Public, nil
+	},
+		jwt.WithValidMethods(i.keys.Methods()),
+		jwt.WithIssuer(i.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(leeway),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("некорректный токен: %w", err)
+	}
+	if !token.Valid {
+		return nil, errors.New("некорректный токен")
+	}
+
+	if claims.Login == "" || claims.SessionID == "" || claims.ID == "" {
+		return nil, errors.New("в токене нет обязательных утверждений")
+	}
+	if claims.Subject != claims.Login {
+		return nil, errors.New("sub токена не совпадает с login")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"net/http"
+	"strconv"
+
+	"cache-web-server/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Middleware создает серверный спан на каждый запрос. Родитель берется
+// из заголовка traceparent, имя спана — метод и шаблон маршрута chi.
+// Должен подключаться к корневому роутеру до объявления маршрутов.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc, ok := Extract(r.Header); ok {
+			ctx = ContextWithRemote(ctx, sc)
+		}
+		ctx, span := Start(ctx, r.Method, KindServer)
+		if span == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer span.End()
+
+		span.SetAttr("http.request.method", r.Method)
+		span.SetAttr("url.path", r.URL.Path)
+		span.SetAttr("client.address", utils.ClientIP(r))
+		span.SetAttr("user_agent.original", r.UserAgent())
+		if r.ContentLength > 0 {
+			span.SetAttr("http.request.body.size", r.ContentLength)
+		}
+
+		sw := utils.NewStatusWriter(w)
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		// Шаблон маршрута известен только после маршрутизации
+		if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttr("http.route", rctx.RoutePattern())
+		}
+		span.SetAttr("http.response.status_code", sw.Status())
+		span.SetAttr("http.response.body.size", sw.Bytes())
+		// Для серверного спана ошибкой считаются только ответы 5xx
+		if sw.Status() >= 500 {
+			span.SetError(strconv.Itoa(sw.Status()))
+		}
+	})
+}
+
+// Transport создает клиентские спаны для исходящих запросов и передает
+// контекст трассы в заголовке traceparent
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip выполняет запрос внутри клиентского спана
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	ctx, span := StartChild(req.Context(), req.Method, KindClient)
+	if span == nil {
+		return base.RoundTrip(req)
+	}
+	defer span.End()
+
+	span.SetAttr("http.request.method", req.Method)
+	span.SetAttr("server.address", req.URL.Hostname())
+	span.SetAttr("url.full", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+
+	// RoundTrip не должен менять исходный запрос
+	req = req.Clone(ctx)
+	Inject(ctx, req.Header)
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttr("http.response.status_code", resp.StatusCode)
+	if resp.StatusCode >= 400 {
+		span.SetError(strconv.Itoa(resp.StatusCode))
+	}
+	return resp, nil
+}
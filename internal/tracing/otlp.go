@@ -0,0 +1,183 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scopeName имя инструментирующей библиотеки в OTLP
+const scopeName = "cache-web-server/internal/tracing"
+
+// OTLPExporter отправляет спаны в коллектор по OTLP/HTTP в кодировке JSON
+type OTLPExporter struct {
+	url     string
+	headers map[string]string
+	service string
+	client  *http.Client
+}
+
+// NewOTLPExporter создает экспортер. endpoint — адрес коллектора,
+// например http://localhost:4318; путь /v1/traces добавляется, если не указан.
+// headers передаются с каждым запросом, например для авторизации в коллекторе.
+func NewOTLPExporter(endpoint, service string, headers map[string]string, timeout time.Duration) *OTLPExporter {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	return &OTLPExporter{
+		url:     url,
+		headers: headers,
+		service: service,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// Export отправляет пачку спанов одним запросом
+func (e *OTLPExporter) Export(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return fmt.Errorf("ошибка при кодировании спанов: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("коллектор недоступен: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("коллектор вернул %s", resp.Status)
+	}
+	return nil
+}
+
+// Структуры OTLP/JSON (ExportTraceServiceRequest). Идентификаторы передаются
+// в шестнадцатеричном виде, 64-битные числа — строками.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		TraceState        string         `json:"traceState,omitempty"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              SpanKind       `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+// request собирает тело запроса к коллектору
+func (e *OTLPExporter) request(spans []*Span) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		span.mu.Lock()
+		s := otlpSpan{
+			TraceID:           span.sc.TraceID.String(),
+			SpanID:            span.sc.SpanID.String(),
+			TraceState:        span.sc.TraceState,
+			Name:              span.name,
+			Kind:              span.kind,
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+			Attributes:        attributes(span.attrs),
+			Status:            otlpStatus{Code: span.status, Message: span.statusMsg},
+		}
+		if span.parent.IsValid() {
+			s.ParentSpanID = span.parent.String()
+		}
+		span.mu.Unlock()
+		out = append(out, s)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: attributes(map[string]interface{}{"service.name": e.service})},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: scopeName},
+			Spans: out,
+		}},
+	}}}
+}
+
+// attributes переводит атрибуты в формат OTLP, ключи сортируются для стабильного вывода
+func attributes(attrs map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := make([]otlpKeyValue, 0, len(keys))
+	for _, key := range keys {
+		var v otlpValue
+		switch value := attrs[key].(type) {
+		case string:
+			v.StringValue = &value
+		case bool:
+			v.BoolValue = &value
+		case int:
+			s := strconv.Itoa(value)
+			v.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(value, 10)
+			v.IntValue = &s
+		case float64:
+			v.DoubleValue = &value
+		default:
+			s := fmt.Sprint(value)
+			v.StringValue = &s
+		}
+		out = append(out, otlpKeyValue{Key: key, Value: v})
+	}
+	return out
+}
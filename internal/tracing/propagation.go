@@ -0,0 +1,72 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Заголовки W3C Trace Context
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+// flagSampled флаг sampled в trace-flags
+const flagSampled = 0x01
+
+// Extract читает родительский спан из заголовков traceparent и tracestate.
+// Некорректный traceparent игнорируется, как требует спецификация.
+func Extract(h http.Header) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(h.Get(TraceParentHeader)), "-")
+	if len(parts) < 4 {
+		return SpanContext{}, false
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	// Версия 00 содержит ровно четыре поля, будущие версии могут добавить новые
+	if len(version) != 2 || version == "ff" || (version == "00" && len(parts) != 4) {
+		return SpanContext{}, false
+	}
+	if len(traceID) != 32 || len(spanID) != 16 || len(flags) != 2 {
+		return SpanContext{}, false
+	}
+
+	var sc SpanContext
+	var f [1]byte
+	if !decodeHex(sc.TraceID[:], traceID) || !decodeHex(sc.SpanID[:], spanID) || !decodeHex(f[:], flags) {
+		return SpanContext{}, false
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	sc.Sampled = f[0]&flagSampled != 0
+	sc.TraceState = h.Get(TraceStateHeader)
+	sc.Remote = true
+	return sc, true
+}
+
+// Inject записывает текущий спан из ctx в заголовки исходящего запроса
+func Inject(ctx context.Context, h http.Header) {
+	sc, ok := parentFromContext(ctx)
+	if !ok {
+		return
+	}
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	h.Set(TraceParentHeader, "00-"+sc.TraceID.String()+"-"+sc.SpanID.String()+"-"+flags)
+	if sc.TraceState != "" {
+		h.Set(TraceStateHeader, sc.TraceState)
+	}
+}
+
+// decodeHex разбирает строку из шестнадцатеричных цифр в нижнем регистре
+func decodeHex(dst []byte, s string) bool {
+	if strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
@@ -0,0 +1,96 @@
+package tracing
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// Exporter отправляет завершенные спаны в хранилище трасс
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+}
+
+// Параметры очереди экспорта
+const (
+	queueSize = 2048
+	batchSize = 512
+)
+
+// Provider собирает завершенные спаны и пачками передает их экспортеру
+type Provider struct {
+	exporter Exporter
+	bound    uint64
+	queue    chan *Span
+	dropped  atomic.Uint64
+}
+
+// NewProvider создает провайдер. ratio — доля сэмплируемых трасс, начатых этим сервисом
+// (от 0 до 1); для трасс, пришедших извне, решение родителя сохраняется.
+func NewProvider(exporter Exporter, ratio float64) *Provider {
+	return &Provider{
+		exporter: exporter,
+		bound:    sampleBound(ratio),
+		queue:    make(chan *Span, queueSize),
+	}
+}
+
+// enqueue ставит спан в очередь экспорта. Если очередь заполнена, спан отбрасывается,
+// чтобы недоступность хранилища трасс не замедляла обработку запросов.
+func (p *Provider) enqueue(span *Span) {
+	select {
+	case p.queue <- span:
+	default:
+		p.dropped.Add(1)
+	}
+}
+
+// Start запускает фоновый экспорт раз в interval или по заполнении пачки.
+// После отмены ctx отправляет оставшиеся спаны и закрывает возвращаемый канал.
+func (p *Provider) Start(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		batch := make([]*Span, 0, batchSize)
+		flush := func(ctx context.Context) {
+			if dropped := p.dropped.Swap(0); dropped > 0 {
+				slog.Warn("очередь экспорта трасс переполнена", "dropped", dropped)
+			}
+			if len(batch) == 0 {
+				return
+			}
+			if err := p.exporter.Export(ctx, batch); err != nil {
+				slog.Warn("ошибка при экспорте трасс", "spans", len(batch), "error", err)
+			}
+			batch = batch[:0]
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				// Забираем все, что успело попасть в очередь
+				for len(p.queue) > 0 {
+					batch = append(batch, <-p.queue)
+					if len(batch) == batchSize {
+						flush(context.Background())
+					}
+				}
+				flush(context.Background())
+				return
+			case span := <-p.queue:
+				batch = append(batch, span)
+				if len(batch) == batchSize {
+					flush(ctx)
+				}
+			case <-ticker.C:
+				flush(ctx)
+			}
+		}
+	}()
+	return done
+}
@@ -0,0 +1,214 @@
+package tracing
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+)
+
+// WrapConnector оборачивает драйвер БД так, что каждый запрос внутри трассы
+// получает дочерний спан. Запросы вне трассы (фоновые задачи, пул соединений)
+// спанов не создают. Спан запроса заканчивается, когда драйвер вернул результат,
+// время чтения строк в него не входит.
+func WrapConnector(c driver.Connector) driver.Connector {
+	return &connector{c}
+}
+
+type connector struct {
+	driver.Connector
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{conn}, nil
+}
+
+// startQuery начинает спан запроса к БД
+func startQuery(ctx context.Context, query string) (context.Context, *Span) {
+	ctx, span := StartChild(ctx, operation(query), KindClient)
+	span.SetAttr("db.system", "postgresql")
+	span.SetAttr("db.statement", query)
+	return ctx, span
+}
+
+// operation возвращает первое слово запроса (SELECT, INSERT и т.д.) для имени спана
+func operation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "SQL"
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// endQuery завершает спан запроса. driver.ErrSkip означает, что database/sql
+// повторит запрос другим способом, и ошибкой не считается.
+func endQuery(span *Span, err error) {
+	if err != nil && !errors.Is(err, driver.ErrSkip) {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// tracedConn соединение, которое создает спаны запросов.
+// Необязательные интерфейсы драйвера передаются исходному соединению.
+type tracedConn struct {
+	driver.Conn
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startQuery(ctx, query)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	endQuery(span, err)
+	return rows, err
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startQuery(ctx, query)
+	res, err := execer.ExecContext(ctx, query, args)
+	endQuery(span, err)
+	return res, err
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tracedStmt{Stmt: stmt, query: query}, nil
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	spanCtx, span := StartChild(ctx, "BEGIN", KindClient)
+	span.SetAttr("db.system", "postgresql")
+
+	var tx driver.Tx
+	var err error
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = beginner.BeginTx(spanCtx, opts)
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	endQuery(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedTx{Tx: tx, ctx: ctx}, nil
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *tracedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// tracedTx транзакция, COMMIT и ROLLBACK которой попадают в трассу запроса, начавшего ее
+type tracedTx struct {
+	driver.Tx
+	ctx context.Context
+}
+
+func (t *tracedTx) Commit() error {
+	_, span := StartChild(t.ctx, "COMMIT", KindClient)
+	span.SetAttr("db.system", "postgresql")
+	err := t.Tx.Commit()
+	endQuery(span, err)
+	return err
+}
+
+func (t *tracedTx) Rollback() error {
+	_, span := StartChild(t.ctx, "ROLLBACK", KindClient)
+	span.SetAttr("db.system", "postgresql")
+	err := t.Tx.Rollback()
+	endQuery(span, err)
+	return err
+}
+
+// tracedStmt подготовленный запрос, выполнения которого создают спаны
+type tracedStmt struct {
+	driver.Stmt
+	query string
+}
+
+func (s *tracedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	ctx, span := startQuery(ctx, s.query)
+	var rows driver.Rows
+	var err error
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValues(args); err == nil {
+			rows, err = s.Stmt.Query(values)
+		}
+	}
+	endQuery(span, err)
+	return rows, err
+}
+
+func (s *tracedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	ctx, span := startQuery(ctx, s.query)
+	var res driver.Result
+	var err error
+	if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+		res, err = execer.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValues(args); err == nil {
+			res, err = s.Stmt.Exec(values)
+		}
+	}
+	endQuery(span, err)
+	return res, err
+}
+
+// namedValues переводит аргументы в старый формат для драйверов без поддержки контекста
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("драйвер не поддерживает именованные параметры")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
@@ -0,0 +1,267 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TraceID идентификатор трассы
+type TraceID [16]byte
+
+// String возвращает идентификатор в шестнадцатеричном виде
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsValid сообщает, что идентификатор не нулевой
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+// SpanID идентификатор спана
+type SpanID [8]byte
+
+// String возвращает идентификатор в шестнадцатеричном виде
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// IsValid сообщает, что идентификатор не нулевой
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// SpanContext данные спана, которые передаются между сервисами
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool
+	TraceState string
+	Remote     bool
+}
+
+// IsValid сообщает, что оба идентификатора заданы
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// SpanKind вид спана, значения совпадают с OTLP
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// Статусы спана, значения совпадают с OTLP
+const (
+	statusUnset = 0
+	statusOK    = 1
+	statusError = 2
+)
+
+// Span операция в трассе. Методы безопасно вызывать у nil,
+// поэтому код не проверяет, включена ли трассировка.
+type Span struct {
+	provider *Provider
+	sc       SpanContext
+	parent   SpanID
+	kind     SpanKind
+
+	mu        sync.Mutex
+	name      string
+	start     time.Time
+	end       time.Time
+	attrs     map[string]interface{}
+	status    int
+	statusMsg string
+}
+
+// SpanContext возвращает данные спана для передачи дальше
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetName меняет имя спана, например когда маршрут стал известен после маршрутизации
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+// SetAttr задает атрибут спана. Значение — строка, bool, целое или float64.
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+// RecordError помечает спан ошибочным
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.status = statusError
+	s.statusMsg = err.Error()
+	s.mu.Unlock()
+}
+
+// SetError помечает спан ошибочным без объекта ошибки, например по коду ответа
+func (s *Span) SetError(msg string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.status = statusError
+	s.statusMsg = msg
+	s.mu.Unlock()
+}
+
+// End завершает спан и передает его на экспорт, если трасса сэмплирована.
+// Повторные вызовы ничего не делают.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.sc.Sampled {
+		s.provider.enqueue(s)
+	}
+}
+
+// spanKey ключ спана в контексте
+type spanKey struct{}
+
+// remoteKey ключ данных родительского спана из другого сервиса
+type remoteKey struct{}
+
+// ContextWithSpan возвращает контекст с текущим спаном
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext возвращает текущий спан, nil если его нет
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemote возвращает контекст с родительским спаном, пришедшим из заголовков
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// parentFromContext возвращает данные родительского спана: локального или пришедшего извне
+func parentFromContext(ctx context.Context) (SpanContext, bool) {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.sc, true
+	}
+	if sc, ok := ctx.Value(remoteKey{}).(SpanContext); ok && sc.IsValid() {
+		return sc, true
+	}
+	return SpanContext{}, false
+}
+
+// Start начинает спан, дочерний к спану из ctx. Если трассировка
+// не настроена, возвращает ctx без изменений и nil.
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	p := current.Load()
+	if p == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		provider: p,
+		kind:     kind,
+		name:     name,
+		start:    time.Now(),
+		attrs:    map[string]interface{}{},
+	}
+	span.sc.SpanID = newSpanID()
+	if parent, ok := parentFromContext(ctx); ok {
+		span.sc.TraceID = parent.TraceID
+		span.sc.Sampled = parent.Sampled
+		span.sc.TraceState = parent.TraceState
+		span.parent = parent.SpanID
+	} else {
+		span.sc.TraceID = newTraceID()
+		span.sc.Sampled = p.sample(span.sc.TraceID)
+	}
+
+	return ContextWithSpan(ctx, span), span
+}
+
+// StartChild начинает спан, только если в ctx уже есть трасса.
+// Используется для операций, которые выполняются и вне запросов (запросы к БД фоновых задач).
+func StartChild(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if _, ok := parentFromContext(ctx); !ok {
+		return ctx, nil
+	}
+	return Start(ctx, name, kind)
+}
+
+// newTraceID генерирует случайный идентификатор трассы
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// newSpanID генерирует случайный идентификатор спана
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// current настроенный провайдер, nil если трассировка отключена
+var current atomic.Pointer[Provider]
+
+// SetProvider делает провайдер текущим, nil отключает трассировку
+func SetProvider(p *Provider) {
+	current.Store(p)
+}
+
+// sampleBound возвращает порог сэмплирования по доле трасс ratio
+func sampleBound(ratio float64) uint64 {
+	switch {
+	case ratio >= 1:
+		return ^uint64(0)
+	case ratio <= 0:
+		return 0
+	}
+	return uint64(ratio * (1 << 63) * 2)
+}
+
+// sample решает, сэмплировать ли новую трассу. Решение зависит только от TraceID,
+// поэтому одинаково на всех сервисах с той же долей.
+func (p *Provider) sample(id TraceID) bool {
+	return p.bound != 0 && binary.BigEndian.Uint64(id[8:]) <= p.bound
+}
@@ -0,0 +1,243 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useProvider включает трассировку на время теста, все трассы сэмплируются
+func useProvider(t *testing.T) *Provider {
+	t.Helper()
+	p := NewProvider(nil, 1)
+	SetProvider(p)
+	t.Cleanup(func() { SetProvider(nil) })
+	return p
+}
+
+// drain забирает завершенные спаны из очереди экспорта
+func drain(p *Provider) []*Span {
+	var spans []*Span
+	for len(p.queue) > 0 {
+		spans = append(spans, <-p.queue)
+	}
+	return spans
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var got otlpRequest
+	var path, auth, contentType string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth, contentType = r.URL.Path, r.Header.Get("Authorization"), r.Header.Get("Content-Type")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	defer collector.Close()
+
+	p := useProvider(t)
+	ctx, parent := Start(context.Background(), "GET /api/docs", KindServer)
+	_, child := Start(ctx, "SELECT", KindClient)
+	child.SetAttr("db.statement", "SELECT 1")
+	child.RecordError(errors.New("timeout"))
+	child.End()
+	parent.End()
+
+	exporter := NewOTLPExporter(collector.URL+"/", "cache", map[string]string{"Authorization": "Bearer secret"}, time.Second)
+	if err := exporter.Export(context.Background(), drain(p)); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/v1/traces" || auth != "Bearer secret" || contentType != "application/json" {
+		t.Fatalf("неожиданный запрос: путь %q, Authorization %q, Content-Type %q", path, auth, contentType)
+	}
+	if len(got.ResourceSpans) != 1 || len(got.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("неожиданная структура запроса: %+v", got)
+	}
+	resource := got.ResourceSpans[0].Resource.Attributes
+	if len(resource) != 1 || resource[0].Key != "service.name" || *resource[0].Value.StringValue != "cache" {
+		t.Fatalf("неожиданные атрибуты ресурса: %+v", resource)
+	}
+
+	spans := got.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("получено %d спанов, ожидалось 2", len(spans))
+	}
+	s := spans[0]
+	if s.Name != "SELECT" || s.Kind != KindClient || s.TraceID != parent.sc.TraceID.String() || s.ParentSpanID != parent.sc.SpanID.String() {
+		t.Fatalf("неожиданный дочерний спан: %+v", s)
+	}
+	if s.Status.Code != statusError || s.Status.Message != "timeout" {
+		t.Fatalf("ошибка спана не передана: %+v", s.Status)
+	}
+	if len(s.Attributes) != 1 || s.Attributes[0].Key != "db.statement" {
+		t.Fatalf("неожиданные атрибуты спана: %+v", s.Attributes)
+	}
+	if spans[1].ParentSpanID != "" {
+		t.Fatalf("у корневого спана есть родитель: %s", spans[1].ParentSpanID)
+	}
+}
+
+func TestOTLPExporterCollectorError(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer collector.Close()
+
+	exporter := NewOTLPExporter(collector.URL, "cache", nil, time.Second)
+	if err := exporter.Export(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("ожидалась ошибка коллектора, получено %v", err)
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	useProvider(t)
+
+	in := http.Header{}
+	in.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	in.Set(TraceStateHeader, "vendor=value")
+	sc, ok := Extract(in)
+	if !ok || !sc.Remote || !sc.Sampled {
+		t.Fatalf("traceparent не разобран: %+v", sc)
+	}
+
+	ctx, span := Start(ContextWithRemote(context.Background(), sc), "GET /", KindServer)
+	if span.sc.TraceID != sc.TraceID || span.parent != sc.SpanID {
+		t.Fatalf("спан не продолжает входящую трассу: %+v", span.sc)
+	}
+
+	out := http.Header{}
+	Inject(ctx, out)
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + span.sc.SpanID.String() + "-01"
+	if out.Get(TraceParentHeader) != want || out.Get(TraceStateHeader) != "vendor=value" {
+		t.Fatalf("исходящие заголовки %v, ожидался traceparent %s", out, want)
+	}
+
+	// Без трассы в контексте заголовки не добавляются
+	out = http.Header{}
+	Inject(context.Background(), out)
+	if len(out) != 0 {
+		t.Fatalf("заголовки без трассы: %v", out)
+	}
+}
+
+func TestExtractRejectsInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+	}
+	for _, value := range tests {
+		h := http.Header{}
+		h.Set(TraceParentHeader, value)
+		if sc, ok := Extract(h); ok {
+			t.Errorf("traceparent %q принят: %+v", value, sc)
+		}
+	}
+
+	// Будущие версии могут содержать дополнительные поля
+	h := http.Header{}
+	h.Set(TraceParentHeader, "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")
+	if sc, ok := Extract(h); !ok || sc.Sampled {
+		t.Errorf("traceparent будущей версии не разобран: %+v", sc)
+	}
+}
+
+// fakeConnector тестовый драйвер БД: запросы с "fail" завершаются ошибкой
+type fakeConnector struct{}
+
+func (fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn{}, nil }
+func (fakeConnector) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return fakeTx{}, nil }
+
+func (fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	if strings.Contains(query, "fail") {
+		return nil, errors.New("relation does not exist")
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (fakeConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return fakeRows{}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string         { return []string{"n"} }
+func (fakeRows) Close() error              { return nil }
+func (fakeRows) Next([]driver.Value) error { return io.EOF }
+
+func TestWrapConnectorSpans(t *testing.T) {
+	p := useProvider(t)
+	db := sql.OpenDB(WrapConnector(fakeConnector{}))
+	defer db.Close()
+
+	// Запросы вне трассы спанов не создают
+	if _, err := db.ExecContext(context.Background(), "DELETE FROM sessions"); err != nil {
+		t.Fatal(err)
+	}
+	if spans := drain(p); len(spans) != 0 {
+		t.Fatalf("спаны запросов вне трассы: %d", len(spans))
+	}
+
+	ctx, parent := Start(context.Background(), "GET /api/docs", KindServer)
+	rows, err := db.QueryContext(ctx, "select id from documents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if _, err := db.ExecContext(ctx, "UPDATE fail SET x = 1"); err == nil {
+		t.Fatal("ожидалась ошибка драйвера")
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := drain(p)
+	names := make([]string, 0, len(spans))
+	for _, span := range spans {
+		names = append(names, span.name)
+		if span.sc.TraceID != parent.sc.TraceID || span.parent != parent.sc.SpanID || span.kind != KindClient {
+			t.Errorf("спан %s не дочерний к запросу: %+v", span.name, span.sc)
+		}
+		if span.attrs["db.system"] != "postgresql" {
+			t.Errorf("у спана %s нет db.system", span.name)
+		}
+	}
+	if got := strings.Join(names, ","); got != "SELECT,UPDATE,BEGIN,COMMIT" {
+		t.Fatalf("спаны %s, ожидались SELECT,UPDATE,BEGIN,COMMIT", got)
+	}
+	if spans[0].attrs["db.statement"] != "select id from documents" || spans[0].status != statusUnset {
+		t.Fatalf("неожиданный спан SELECT: %+v", spans[0].attrs)
+	}
+	if spans[1].status != statusError || spans[1].statusMsg != "relation does not exist" {
+		t.Fatalf("ошибка запроса не записана: %d %q", spans[1].status, spans[1].statusMsg)
+	}
+}
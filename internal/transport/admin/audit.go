@@ -0,0 +1,112 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cache-web-server/internal/audit"
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/utils"
+)
+
+// auditPageSize размер страницы журнала аудита по умолчанию и максимальный
+const (
+	auditPageSize    = 100
+	auditMaxPageSize = 1000
+)
+
+// auditFilter читает фильтр журнала аудита из параметров запроса
+func auditFilter(r *http.Request) (audit.Filter, bool) {
+	q := r.URL.Query()
+	f := audit.Filter{
+		Actor:  q.Get("actor"),
+		Action: q.Get("action"),
+		Target: q.Get("target"),
+	}
+
+	var err error
+	if v := q.Get("from"); v != "" {
+		if f.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, false
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if f.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, false
+		}
+	}
+	if v := q.Get("after"); v != "" {
+		if f.AfterID, err = strconv.ParseInt(v, 10, 64); err != nil || f.AfterID < 0 {
+			return f, false
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit <= 0 {
+			return f, false
+		}
+	}
+	return f, true
+}
+
+// AuditHandler возвращает страницу журнала аудита.
+// Следующая страница запрашивается с after = id последнего события.
+func AuditHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		f, ok := auditFilter(r)
+		if !ok {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+		if f.Limit == 0 {
+			f.Limit = auditPageSize
+		}
+		if f.Limit > auditMaxPageSize {
+			f.Limit = auditMaxPageSize
+		}
+
+		events, err := audit.List(r.Context(), db, f)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		utils.ActResponse(w, "events", events)
+	}
+}
+
+// ExportAuditHandler выгружает журнал аудита в формате JSON Lines, по событию на строку
+func ExportAuditHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		f, ok := auditFilter(r)
+		if !ok {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+
+		// После начала выгрузки статус уже не изменить, ошибку только логируем
+		enc := json.NewEncoder(w)
+		err := audit.Each(r.Context(), db, f, func(e models.AuditEvent) error {
+			return enc.Encode(e)
+		})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "ошибка при выгрузке журнала аудита", "error", err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"cache-web-server/internal/audit"
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/repository"
+	"cache-web-server/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ListCertificatesHandler возвращает сертификаты, привязанные к пользователю
+func ListCertificatesHandler(users repository.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		login := chi.URLParam(r, "login")
+
+		certificates, err := users.Certificates(r.Context(), login)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		utils.ActResponse(w, "certificates", certificates)
+	}
+}
+
+// AddCertificateHandler привязывает клиентский сертификат к пользователю.
+// Пара издатель и субъект может принадлежать только одному пользователю.
+func AddCertificateHandler(users repository.UserRepository, auditLog audit.Execer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		login := chi.URLParam(r, "login")
+
+		cert, ok := decodeCertificate(w, r)
+		if !ok {
+			return
+		}
+
+		err := users.AddCertificate(r.Context(), login, cert)
+		if errors.Is(err, repository.ErrExists) {
+			utils.ErrorResponse(w, 409)
+			return
+		}
+		if !userChanged(w, r, err) {
+			return
+		}
+
+		admin := r.Context().Value("login").(string)
+		audit.Record(auditLog, r, admin, audit.ActionCertificateAdd, login, map[string]interface{}{"issuer": cert.Issuer, "subject": cert.Subject})
+
+		utils.ActResponse(w, login, true)
+	}
+}
+
+// RemoveCertificateHandler отвязывает клиентский сертификат от пользователя
+func RemoveCertificateHandler(users repository.UserRepository, auditLog audit.Execer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		login := chi.URLParam(r, "login")
+
+		cert, ok := decodeCertificate(w, r)
+		if !ok {
+			return
+		}
+
+		if !userChanged(w, r, users.RemoveCertificate(r.Context(), login, cert)) {
+			return
+		}
+
+		admin := r.Context().Value("login").(string)
+		audit.Record(auditLog, r, admin, audit.ActionCertificateRemove, login, map[string]interface{}{"issuer": cert.Issuer, "subject": cert.Subject})
+
+		utils.ActResponse(w, login, true)
+	}
+}
+
+// decodeCertificate читает издателя и субъекта сертификата из тела запроса, оба обязательны
+func decodeCertificate(w http.ResponseWriter, r *http.Request) (models.ClientCertificate, bool) {
+	var cert models.ClientCertificate
+	if err := json.NewDecoder(r.Body).Decode(&cert); err != nil || cert.Issuer == "" || cert.Subject == "" {
+		utils.ErrorResponse(w, 400)
+		return cert, false
+	}
+	return cert, true
+}
@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cache-web-server/internal/audit/audittest"
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/repository/memory"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestCertificates(t *testing.T) {
+	ctx := context.Background()
+	users := memory.NewUsers(memory.NewDocuments())
+	for _, login := range []string{"alice", "bob"} {
+		if err := users.Create(ctx, login, "hash", models.RoleUser, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log := &audittest.Recorder{}
+
+	router := chi.NewRouter()
+	router.Post("/api/admin/users/{login}/certificates", AddCertificateHandler(users, log))
+	router.Delete("/api/admin/users/{login}/certificates", RemoveCertificateHandler(users, log))
+	send := func(method, login, body string) int {
+		r := httptest.NewRequest(method, "/api/admin/users/"+login+"/certificates", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "login", "admin")))
+		return w.Code
+	}
+
+	cert := `{"issuer": "CN=Corp CA", "subject": "CN=alice"}`
+	tests := []struct {
+		name   string
+		method string
+		login  string
+		body   string
+		want   int
+	}{
+		{name: "привязка", method: http.MethodPost, login: "alice", body: cert, want: 200},
+		{name: "сертификат другого пользователя", method: http.MethodPost, login: "bob", body: cert, want: 409},
+		{name: "нет пользователя", method: http.MethodPost, login: "carol", body: `{"issuer": "CN=Corp CA", "subject": "CN=carol"}`, want: 404},
+		{name: "без субъекта", method: http.MethodPost, login: "alice", body: `{"issuer": "CN=Corp CA"}`, want: 400},
+		{name: "отвязка чужого", method: http.MethodDelete, login: "bob", body: cert, want: 404},
+		{name: "отвязка", method: http.MethodDelete, login: "alice", body: cert, want: 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := send(tt.method, tt.login, tt.body); code != tt.want {
+				t.Fatalf("статус %d, ожидался %d", code, tt.want)
+			}
+		})
+	}
+
+	if _, err := users.FindByCertificate(ctx, models.ClientCertificate{Issuer: "CN=Corp CA", Subject: "CN=alice"}); err == nil {
+		t.Fatal("сертификат остался привязан")
+	}
+	if got := strings.Join(log.Actions(), ","); got != "user.certificate_add,user.certificate_remove" {
+		t.Fatalf("журнал аудита: %s", got)
+	}
+}
@@ -0,0 +1,240 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"cache-web-server/internal/audit"
+	"cache-web-server/internal/loginguard"
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/repository"
+	"cache-web-server/internal/sessions"
+	"cache-web-server/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ListUsersHandler возвращает список пользователей со статистикой использования
+func ListUsersHandler(users repository.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		list, err := users.List(r.Context())
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		utils.ActResponse(w, "users", list)
+	}
+}
+
+// SetDisabledHandler отключает или включает учетную запись.
+// При отключении все сессии пользователя отзываются.
+func SetDisabledHandler(users repository.UserRepository, store *sessions.Store, auditLog audit.Execer, disabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		login := chi.URLParam(r, "login")
+
+		// Администратор не может отключить сам себя
+		if disabled && login == r.Context().Value("login").(string) {
+			utils.ErrorResponse(w, 409)
+			return
+		}
+
+		if !userChanged(w, r, users.SetDisabled(r.Context(), login, disabled)) {
+			return
+		}
+
+		if disabled {
+			if err := store.RevokeAll(r.Context(), login, ""); err != nil {
+				utils.ServerError(w, r, err)
+				return
+			}
+		}
+
+		action := audit.ActionUserEnable
+		if disabled {
+			action = audit.ActionUserDisable
+		}
+		audit.Record(auditLog, r, r.Context().Value("login").(string), action, login, nil)
+
+		utils.ActResponse(w, login, true)
+	}
+}
+
+// SetEmailHandler задает email пользователя, по которому его учетная запись
+// связывается с пользователем IdP при входе через OIDC. Пустой email удаляет его.
+func SetEmailHandler(users repository.UserRepository, auditLog audit.Execer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		login := chi.URLParam(r, "login")
+
+		var req struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+		if req.Email != "" && !models.ValidEmail(req.Email) {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		err := users.SetEmail(r.Context(), login, req.Email)
+		if errors.Is(err, repository.ErrExists) {
+			utils.ErrorResponse(w, 409)
+			return
+		}
+		if !userChanged(w, r, err) {
+			return
+		}
+
+		audit.Record(auditLog, r, r.Context().Value("login").(string), audit.ActionUserEmail, login, map[string]interface{}{"email": req.Email})
+
+		utils.ActResponse(w, login, true)
+	}
+}
+
+// ForceResetHandler требует от пользователя сменить пароль и отзывает его сессии
+func ForceResetHandler(users repository.UserRepository, store *sessions.Store, auditLog audit.Execer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		login := chi.URLParam(r, "login")
+
+		if !userChanged(w, r, users.RequireReset(r.Context(), login)) {
+			return
+		}
+
+		if err := store.RevokeAll(r.Context(), login, ""); err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		audit.Record(auditLog, r, r.Context().Value("login").(string), audit.ActionUserForceReset, login, nil)
+
+		utils.ActResponse(w, login, true)
+	}
+}
+
+// UnlockHandler снимает блокировку входа, наложенную за перебор паролей
+func UnlockHandler(guard *loginguard.Guard, auditLog audit.Execer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		login := chi.URLParam(r, "login")
+
+		if err := guard.Unlock(r.Context(), login); err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		audit.Record(auditLog, r, r.Context().Value("login").(string), audit.ActionUserUnlock, login, nil)
+
+		utils.ActResponse(w, login, true)
+	}
+}
+
+// DeleteUserHandler удаляет пользователя.
+// Параметр documents=reassign&to=<login> передает его документы другому пользователю,
+// documents=delete удаляет их окончательно вместе с историей версий, минуя корзину:
+// логин можно зарегистрировать заново, и новый пользователь получил бы чужую корзину.
+func DeleteUserHandler(users repository.UserRepository, auditLog audit.Execer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		login := chi.URLParam(r, "login")
+		mode := r.URL.Query().Get("documents")
+		to := r.URL.Query().Get("to")
+
+		if login == r.Context().Value("login").(string) {
+			utils.ErrorResponse(w, 409)
+			return
+		}
+		if mode != "delete" && (mode != "reassign" || to == "" || to == login) {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		// Документы удаляются или передаются новому владельцу вместе с пользователем
+		if mode == "delete" {
+			to = ""
+		}
+		err := users.Delete(r.Context(), login, to)
+		if errors.Is(err, repository.ErrNotFound) {
+			utils.ErrorResponse(w, 404)
+			return
+		}
+		if errors.Is(err, repository.ErrUnknownTarget) {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		audit.Record(auditLog, r, r.Context().Value("login").(string), audit.ActionUserDelete, login, map[string]interface{}{
+			"documents": mode,
+			"to":        to,
+		})
+
+		utils.ActResponse(w, login, true)
+	}
+}
+
+// UserSessionsHandler возвращает активные сессии пользователя
+func UserSessionsHandler(store *sessions.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		login := chi.URLParam(r, "login")
+
+		list, err := store.List(r.Context(), login)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		utils.ActResponse(w, "sessions", list)
+	}
+}
+
+// userChanged пишет ответ с ошибкой изменения пользователя, 404 если его нет
+func userChanged(w http.ResponseWriter, r *http.Request, err error) bool {
+	if errors.Is(err, repository.ErrNotFound) {
+		utils.ErrorResponse(w, 404)
+		return false
+	}
+	if err != nil {
+		utils.ServerError(w, r, err)
+		return false
+	}
+	return true
+}
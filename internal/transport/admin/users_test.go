@@ -0,0 +1,89 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cache-web-server/internal/audit/audittest"
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/repository"
+	"cache-web-server/internal/repository/memory"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// deleteUser выполняет DELETE /api/admin/users/{login} от имени администратора admin
+func deleteUser(users repository.UserRepository, log *audittest.Recorder, target string) *httptest.ResponseRecorder {
+	router := chi.NewRouter()
+	router.Delete("/api/admin/users/{login}", DeleteUserHandler(users, log))
+	r := httptest.NewRequest(http.MethodDelete, "/api/admin/users/"+target, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "login", "admin")))
+	return w
+}
+
+func TestDeleteUser(t *testing.T) {
+	ctx := context.Background()
+	docs := memory.NewDocuments()
+	users := memory.NewUsers(docs)
+	for _, login := range []string{"admin", "alice", "bob"} {
+		if err := users.Create(ctx, login, "hash", models.RoleUser, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []string{"a1", "a2"} {
+		if err := docs.Create(ctx, repository.NewDocument{ID: id, Name: id, Owner: "alice"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := docs.Create(ctx, repository.NewDocument{ID: "b1", Name: "b1", Owner: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	log := &audittest.Recorder{}
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{target: "alice", want: 400},
+		{target: "alice?documents=reassign", want: 400},
+		{target: "alice?documents=reassign&to=alice", want: 400},
+		{target: "alice?documents=reassign&to=nobody", want: 400},
+		{target: "admin?documents=delete", want: 409},
+		{target: "nobody?documents=delete", want: 404},
+	}
+	for _, tt := range tests {
+		if w := deleteUser(users, log, tt.target); w.Code != tt.want {
+			t.Errorf("%s: статус %d, ожидался %d", tt.target, w.Code, tt.want)
+		}
+	}
+
+	// Документы alice переходят bob
+	if w := deleteUser(users, log, "alice?documents=reassign&to=bob"); w.Code != http.StatusOK {
+		t.Fatalf("удаление с передачей документов: статус %d", w.Code)
+	}
+	if perm, err := docs.Access(ctx, "a1", "bob", false); err != nil || perm != models.PermOwner {
+		t.Fatalf("документ не передан: %q, %v", perm, err)
+	}
+
+	// Документы bob удаляются вместе с ним, минуя корзину
+	if w := deleteUser(users, log, "bob?documents=delete"); w.Code != http.StatusOK {
+		t.Fatalf("удаление с документами: статус %d", w.Code)
+	}
+	for _, id := range []string{"a1", "a2", "b1"} {
+		if _, _, err := docs.Get(ctx, id); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("документ %s остался: %v", id, err)
+		}
+	}
+	if trash, _ := docs.ListTrash(ctx, "bob"); len(trash) != 0 {
+		t.Errorf("документы попали в корзину: %v", trash)
+	}
+
+	if got := strings.Join(log.Actions(), ","); got != "user.delete,user.delete" {
+		t.Fatalf("журнал аудита: %s", got)
+	}
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cache-web-server/internal/apikeys"
+	"cache-web-server/internal/audit"
+	"cache-web-server/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// apiKeyRequest тело запроса на создание API-ключа
+type apiKeyRequest struct {
+	Name    string   `json:"name"`
+	Scopes  []string `json:"scopes"`
+	Expires string   `json:"expires"`
+}
+
+// hasSession проверяет, что запрос выполнен по токену сессии, а не по API-ключу.
+// Управлять ключами можно только из сессии, чтобы утекший ключ не мог выпустить новые.
+func hasSession(r *http.Request) bool {
+	sessionID, _ := r.Context().Value("session").(string)
+	return sessionID != ""
+}
+
+// CreateAPIKeyHandler выпускает персональный API-ключ
+func CreateAPIKeyHandler(store *apikeys.Store, auditLog audit.Execer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		if !hasSession(r) {
+			utils.ErrorResponse(w, 403)
+			return
+		}
+
+		login := r.Context().Value("login").(string)
+
+		var req apiKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		// По умолчанию ключ дает полный доступ
+		if len(req.Scopes) == 0 {
+			req.Scopes = []string{apikeys.ScopeRead, apikeys.ScopeWrite}
+		}
+		if !apikeys.ValidScopes(req.Scopes) {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		var expires *time.Time
+		if req.Expires != "" {
+			t, err := time.Parse(time.RFC3339, req.Expires)
+			if err != nil || !t.After(time.Now()) {
+				utils.ErrorResponse(w, 400)
+				return
+			}
+			expires = &t
+		}
+
+		key, err := store.Create(r.Context(), login, req.Name, req.Scopes, expires)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		audit.Record(auditLog, r, login, audit.ActionAPIKeyCreate, login, map[string]interface{}{
+			"id":      key.ID,
+			"name":    key.Name,
+			"prefix":  key.Prefix,
+			"scopes":  key.Scopes,
+			"expires": key.Expires,
+		})
+
+		utils.ActResponse(w, "key", key)
+	}
+}
+
+// ListAPIKeysHandler возвращает API-ключи пользователя без самих ключей
+func ListAPIKeysHandler(store *apikeys.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		login := r.Context().Value("login").(string)
+
+		keys, err := store.List(r.Context(), login)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		utils.ActResponse(w, "keys", keys)
+	}
+}
+
+// RevokeAPIKeyHandler отзывает API-ключ
+func RevokeAPIKeyHandler(store *apikeys.Store, auditLog audit.Execer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		if !hasSession(r) {
+			utils.ErrorResponse(w, 403)
+			return
+		}
+
+		login := r.Context().Value("login").(string)
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		err = store.Revoke(r.Context(), login, id)
+		if errors.Is(err, apikeys.ErrNotFound) {
+			utils.ErrorResponse(w, 404)
+			return
+		}
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		audit.Record(auditLog, r, login, audit.ActionAPIKeyRevoke, login, map[string]interface{}{"id": id})
+
+		utils.ActResponse(w, strconv.Itoa(id), true)
+	}
+}
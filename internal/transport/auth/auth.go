@@ -1,33 +1,39 @@
 package auth
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"regexp"
+	"strconv"
+	"sync"
+	"time"
 
+	"cache-web-server/config"
+	"cache-web-server/internal/audit"
+	"cache-web-server/internal/loginguard"
+	"cache-web-server/internal/metrics"
 	"cache-web-server/internal/models"
+	"cache-web-server/internal/repository"
+	"cache-web-server/internal/sessions"
+	"cache-web-server/internal/tokens"
 	"cache-web-server/internal/utils"
 
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// RegisterHandler обрабатывает POST запрос для регистрации нового пользователя
-func RegisterHandler(db *sql.DB, adminToken string) http.HandlerFunc {
+// RegisterHandler обрабатывает POST запрос для регистрации нового пользователя.
+// Доступен только администраторам, проверка роли выполняется middleware.
+func RegisterHandler(users repository.UserRepository, auditLog audit.Execer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			utils.ErrorResponse(w, 405)
 			return
 		}
 
-		// Проверяем токен администратора
-		if r.Header.Get("Authorization") != adminToken {
-			utils.ErrorResponse(w, 403)
-			return
-		}
-
 		var req models.User
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			utils.ErrorResponse(w, 400)
@@ -35,7 +41,7 @@ func RegisterHandler(db *sql.DB, adminToken string) http.HandlerFunc {
 		}
 
 		// Проверяем формат логина
-		if !regexp.MustCompile(`^[a-zA-Z0-9]{8,}$`).MatchString(req.Login) {
+		if !validLogin(req.Login) {
 			utils.ErrorResponse(w, 400)
 			return
 		}
@@ -46,36 +52,97 @@ func RegisterHandler(db *sql.DB, adminToken string) http.HandlerFunc {
 			return
 		}
 
-		// Хэшируем пароль
-		hashedPassword, err := hashPassword(req.Pswd)
-		if err != nil {
-			utils.ErrorResponse(w, 500)
+		// Проверяем роль, по умолчанию обычный пользователь
+		if req.Role == "" {
+			req.Role = models.RoleUser
+		}
+		if !models.ValidRole(req.Role) {
+			utils.ErrorResponse(w, 400)
 			return
 		}
 
-		// Добавляем пользователя в базу
-		var userID int
-		query := `INSERT INTO users (login, password) VALUES ($1, $2) RETURNING id`
-		err = db.QueryRow(query, req.Login, hashedPassword).Scan(&userID)
+		// email необязателен, по нему учетная запись связывается с пользователем IdP
+		if req.Email != "" && !models.ValidEmail(req.Email) {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		err := createUser(r.Context(), users, req.Login, req.Pswd, req.Role, req.Email)
+		if errors.Is(err, repository.ErrExists) {
+			utils.ErrorResponse(w, 409)
+			return
+		}
 		if err != nil {
-			utils.ErrorResponse(w, 500)
+			utils.ServerError(w, r, err)
 			return
 		}
 
+		admin, _ := r.Context().Value("login").(string)
+		audit.Record(auditLog, r, admin, audit.ActionRegister, req.Login, map[string]interface{}{"role": req.Role})
+
 		utils.ActResponse(w, "login", req.Login)
 	}
 }
 
-// validPass проверяет пароль на соответствие требованиям
+// BootstrapAdmin создает первого администратора.
+// Работает, только пока в системе нет ни одного администратора.
+func BootstrapAdmin(ctx context.Context, users repository.UserRepository, auditLog audit.Execer, login, pswd string) error {
+	if !validLogin(login) {
+		return errors.New("логин должен состоять минимум из 8 латинских букв и цифр")
+	}
+	if !validPass(pswd) {
+		return errors.New("пароль не соответствует требованиям")
+	}
+
+	exists, err := users.AdminExists(ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return errors.New("администратор уже существует")
+	}
+
+	if err := createUser(ctx, users, login, pswd, models.RoleAdmin, ""); err != nil {
+		return err
+	}
+
+	audit.Record(auditLog, nil, "", audit.ActionRegister, login, map[string]interface{}{"role": models.RoleAdmin, "bootstrap": true})
+	return nil
+}
+
+// createUser хэширует пароль и добавляет пользователя
+func createUser(ctx context.Context, users repository.UserRepository, login, pswd, role, email string) error {
+	hashedPassword, err := hashPassword(pswd)
+	if err != nil {
+		return err
+	}
+	return users.Create(ctx, login, hashedPassword, role, email)
+}
+
+// validLogin проверяет формат логина
+func validLogin(login string) bool {
+	return regexp.MustCompile(`^[a-zA-Z0-9]{8,}$`).MatchString(login)
+}
+
+// validPass проверяет пароль на соответствие политике паролей
 func validPass(pswd string) bool {
-	if len(pswd) < 8 {
+	policy := config.Password()
+	if len(pswd) < policy.MinLength {
+		return false
+	}
+	if policy.RequireUpper && !regexp.MustCompile(`[A-Z]`).MatchString(pswd) {
+		return false
+	}
+	if policy.RequireLower && !regexp.MustCompile(`[a-z]`).MatchString(pswd) {
+		return false
+	}
+	if policy.RequireDigit && !regexp.MustCompile(`\d`).MatchString(pswd) {
 		return false
 	}
-	hasUpper := regexp.MustCompile(`[A-Z]`).MatchString(pswd)
-	hasLower := regexp.MustCompile(`[a-z]`).MatchString(pswd)
-	hasNumber := regexp.MustCompile(`\d`).MatchString(pswd)
-	hasSpecial := regexp.MustCompile(`[^a-zA-Z0-9]`).MatchString(pswd)
-	return hasUpper && hasLower && hasNumber && hasSpecial
+	if policy.RequireSpecial && !regexp.MustCompile(`[^a-zA-Z0-9]`).MatchString(pswd) {
+		return false
+	}
+	return true
 }
 
 // hashPassword хэширует пароль
@@ -87,8 +154,10 @@ func hashPassword(pswd string) (string, error) {
 	return string(hashedPass), nil
 }
 
-// AuthHandler обрабатывает POST запрос для аутентификации пользователя
-func AuthHandler(db *sql.DB, secretKey string) http.HandlerFunc {
+// AuthHandler обрабатывает POST запрос для аутентификации пользователя.
+// Неудачные попытки учитываются guard, для неизвестных логинов
+// ответ и время обработки такие же, как для неверного пароля.
+func AuthHandler(users repository.UserRepository, auditLog audit.Execer, issuer *tokens.Issuer, store *sessions.Store, guard *loginguard.Guard, refreshTTL time.Duration) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			utils.ErrorResponse(w, 405)
@@ -101,47 +170,185 @@ func AuthHandler(db *sql.DB, secretKey string) http.HandlerFunc {
 			return
 		}
 
-		// Ищем пользователя в базе
-		var hashedPassword string
-		var userID int
-		var token *string
-		query := `SELECT id, password, token FROM users WHERE login = $1`
-		err := db.QueryRow(query, req.Login).Scan(&userID, &hashedPassword, &token)
+		// Проверяем, не заблокирован ли вход для логина или IP
+		ip := utils.ClientIP(r)
+		retryAfter, err := guard.Check(r.Context(), req.Login, ip)
 		if err != nil {
-			utils.ErrorResponse(w, 500)
+			utils.ServerError(w, r, err)
+			return
+		}
+		if retryAfter > 0 {
+			loginFailed(auditLog, r, req.Login, "password", "locked")
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			utils.ErrorResponse(w, 429)
 			return
 		}
 
+		// Ищем пользователя
+		account, err := users.Get(r.Context(), req.Login)
+		found := err == nil
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		// Для неизвестного логина сравниваем с фиктивным хэшем, чтобы время ответа не отличалось
+		if !found {
+			account.PasswordHash = dummyHash()
+		}
+
 		// Сравниваем хэш пароля
-		if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.Pswd)); err != nil {
+		if err := bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(req.Pswd)); err != nil || !found {
+			if err := guard.Fail(r.Context(), req.Login, ip); err != nil {
+				slog.ErrorContext(r.Context(), "не удалось учесть неудачный вход", "error", err)
+			}
+			loginFailed(auditLog, r, req.Login, "password", "credentials")
 			utils.ErrorResponse(w, 401)
 			return
 		}
 
-		// Генерируем токен
-		tokenString, err := generateJWT(req.Login, secretKey)
+		if err := guard.Succeed(r.Context(), req.Login); err != nil {
+			slog.ErrorContext(r.Context(), "не удалось сбросить счетчик входов", "error", err)
+		}
+
+		// Отключенным пользователям и пользователям с обязательной сменой пароля вход запрещен
+		if account.Disabled || account.MustReset {
+			reason := "disabled"
+			if !account.Disabled {
+				reason = "must_reset_password"
+			}
+			loginFailed(auditLog, r, req.Login, "password", reason)
+			utils.ErrorResponse(w, 403)
+			return
+		}
+
+		if startSession(w, r, issuer, store, req.Login, refreshTTL) {
+			audit.Record(auditLog, r, req.Login, audit.ActionLogin, req.Login, map[string]interface{}{"method": "password"})
+		}
+	}
+}
+
+// loginFailed записывает неудачную попытку входа в журнал аудита и метрики
+func loginFailed(auditLog audit.Execer, r *http.Request, login, method, reason string) {
+	metrics.AuthFailures.Inc(reason)
+	audit.Record(auditLog, r, login, audit.ActionLoginFailed, login, map[string]interface{}{"reason": reason, "method": method})
+}
+
+// startSession создает новую сессию пользователя и отвечает парой токенов.
+// Старые сессии пользователя остаются активными. Возвращает false, если ответ — ошибка.
+func startSession(w http.ResponseWriter, r *http.Request, issuer *tokens.Issuer, store *sessions.Store, login string, refreshTTL time.Duration) bool {
+	sessionID, err := sessions.NewID()
+	if err != nil {
+		utils.ServerError(w, r, err)
+		return false
+	}
+	if err := store.Create(r.Context(), sessionID, login, utils.ClientIP(r), r.UserAgent()); err != nil {
+		utils.ServerError(w, r, err)
+		return false
+	}
+
+	// Выпускаем refresh-токен сессии
+	refresh, err := tokens.NewRefreshToken()
+	if err != nil {
+		utils.ServerError(w, r, err)
+		return false
+	}
+	if err := store.SaveRefresh(r.Context(), sessionID, refresh, refreshTTL); err != nil {
+		utils.ServerError(w, r, err)
+		return false
+	}
+
+	// Генерируем access-токен
+	tokenString, err := issuer.Issue(login, sessionID)
+	if err != nil {
+		utils.ServerError(w, r, err)
+		return false
+	}
+
+	utils.TokenResponse(w, tokenString, refresh, issuer.TTL())
+	return true
+}
+
+var (
+	dummyOnce sync.Once
+	dummy     string
+)
+
+// dummyHash возвращает bcrypt-хэш случайного пароля той же стоимости, что и настоящие
+func dummyHash() string {
+	dummyOnce.Do(func() {
+		secret, err := tokens.NewRefreshToken()
+		if err != nil {
+			secret = "dummy-password"
+		}
+		dummy, _ = hashPassword(secret)
+	})
+	return dummy
+}
+
+// refreshRequest тело запроса на обновление токенов
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshHandler обменивает refresh-токен на новую пару токенов.
+// Повторное использование refresh-токена отзывает всю сессию.
+func RefreshHandler(issuer *tokens.Issuer, store *sessions.Store, refreshTTL time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		var req refreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		next, err := tokens.NewRefreshToken()
 		if err != nil {
-			utils.ErrorResponse(w, 500)
+			utils.ServerError(w, r, err)
 			return
 		}
 
-		// Обновляем токен в базе данных для этого пользователя
-		query = `UPDATE users SET token = $1 WHERE id = $2`
-		_, err = db.Exec(query, tokenString, userID)
+		// Обмениваем refresh-токен на новый
+		sessionID, login, err := store.Rotate(r.Context(), req.RefreshToken, next, refreshTTL)
+		if errors.Is(err, sessions.ErrNotFound) || errors.Is(err, sessions.ErrRefreshReused) {
+			metrics.AuthFailures.Inc("refresh")
+			utils.ErrorResponse(w, 401)
+			return
+		}
 		if err != nil {
-			utils.ErrorResponse(w, 500)
+			utils.ServerError(w, r, err)
 			return
 		}
 
-		utils.ActResponse(w, "token", tokenString)
+		tokenString, err := issuer.Issue(login, sessionID)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		utils.TokenResponse(w, tokenString, next, issuer.TTL())
 	}
 }
 
-// generateJWT создает JWT для пользователя
-func generateJWT(login string, secretKey string) (string, error) {
-	claims := jwt.MapClaims{
-		"login": login,
+// JWKSHandler отдает открытые ключи подписи для проверки токенов другими сервисами.
+// Если ключи асимметричные не настроены (ring == nil), отдает пустой набор.
+func JWKSHandler(ring *tokens.KeyRing) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		set := tokens.JWKS{Keys: []tokens.JWK{}}
+		if ring != nil {
+			set = ring.JWKS()
+		}
+
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(tokens.JWKSMaxAge.Seconds())))
+		utils.WriteJSONResponse(w, 200, set)
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secretKey))
 }
@@ -2,50 +2,201 @@ package middleware
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"net/http"
 	"strings"
 
+	"cache-web-server/internal/apikeys"
+	"cache-web-server/internal/logging"
+	"cache-web-server/internal/metrics"
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/repository"
+	"cache-web-server/internal/sessions"
+	"cache-web-server/internal/tokens"
+	"cache-web-server/internal/tracing"
 	"cache-web-server/internal/utils"
-
-	"github.com/golang-jwt/jwt/v5"
 )
 
-// AuthMiddleware проверяет JWT токен
-func AuthMiddleware(db *sql.DB, JWTSecret string) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
+// APIKeyHeader заголовок с персональным API-ключом
+const APIKeyHeader = "X-API-Key"
+
+// AuthMiddleware проверяет JWT токен и то, что его сессия не отозвана,
+// персональный API-ключ из заголовка X-API-Key либо клиентский сертификат TLS
+func AuthMiddleware(users repository.UserRepository, issuer *tokens.Issuer, store *sessions.Store, keys *apikeys.Store) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Аутентификация попадает в трассу отдельным спаном,
+			// обработчик продолжает трассу запроса
+			parent := tracing.SpanFromContext(r.Context())
+			ctx, span := tracing.StartChild(r.Context(), "auth", tracing.KindInternal)
+			defer span.End()
+			r = r.WithContext(ctx)
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				span.End()
+				handler.ServeHTTP(w, r.WithContext(tracing.ContextWithSpan(r.Context(), parent)))
+			})
+
+			// Машинные клиенты авторизуются API-ключом
+			if apiKey := r.Header.Get(APIKeyHeader); apiKey != "" {
+				span.SetAttr("auth.method", "api_key")
+				login, scopes, err := keys.Authenticate(r.Context(), apiKey)
+				if errors.Is(err, apikeys.ErrInvalid) {
+					metrics.AuthFailures.Inc("api_key")
+					utils.ErrorResponse(w, 401)
+					return
+				}
+				if err != nil {
+					utils.ServerError(w, r, err)
+					return
+				}
+
+				// Ключ только для чтения не дает изменять данные
+				if !allowedByScopes(r.Method, scopes) {
+					utils.ErrorResponse(w, 403)
+					return
+				}
+
+				role, ok := activeUserRole(w, r, users, login)
+				if !ok {
+					return
+				}
+
+				logging.SetLogin(r.Context(), login)
+				ctx := context.WithValue(r.Context(), "login", login)
+				ctx = context.WithValue(ctx, "role", role)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
 			// Проверяем заголовок с токеном
 			authHeader := r.Header.Get("Authorization")
+
+			// Без токена клиент может авторизоваться проверенным сертификатом TLS
+			if authHeader == "" && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+				span.SetAttr("auth.method", "certificate")
+				cert := r.TLS.VerifiedChains[0][0]
+				login, err := users.FindByCertificate(r.Context(), models.ClientCertificate{Issuer: cert.Issuer.String(), Subject: cert.Subject.String()})
+				if errors.Is(err, repository.ErrNotFound) {
+					metrics.AuthFailures.Inc("certificate")
+					utils.ErrorResponse(w, 401)
+					return
+				}
+				if err != nil {
+					utils.ServerError(w, r, err)
+					return
+				}
+
+				role, ok := activeUserRole(w, r, users, login)
+				if !ok {
+					return
+				}
+
+				logging.SetLogin(r.Context(), login)
+				ctx := context.WithValue(r.Context(), "login", login)
+				ctx = context.WithValue(ctx, "role", role)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
 			if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+				metrics.AuthFailures.Inc("missing")
 				utils.ErrorResponse(w, 401)
 				return
 			}
 
-			// Разбираем токен
+			// Разбираем токен с проверкой алгоритма, срока действия и издателя
+			span.SetAttr("auth.method", "token")
 			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			claims := jwt.MapClaims{}
-			token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
-				return []byte(JWTSecret), nil
-			})
-
-			if err != nil || !token.Valid {
+			claims, err := issuer.Parse(tokenString)
+			if err != nil {
+				metrics.AuthFailures.Inc("token")
 				utils.ErrorResponse(w, 401)
 				return
 			}
 
 			// Проверяем существование пользователя в БД
-			var userID int
-			query := `SELECT id FROM users WHERE login = $1`
-			err = db.QueryRow(query, claims["login"]).Scan(&userID)
+			role, ok := activeUserRole(w, r, users, claims.Login)
+			if !ok {
+				return
+			}
+
+			// Проверяем, что сессия токена не отозвана
+			active, err := store.Active(r.Context(), claims.SessionID, claims.Login)
 			if err != nil {
+				utils.ServerError(w, r, err)
+				return
+			}
+			if !active {
+				metrics.AuthFailures.Inc("session")
 				utils.ErrorResponse(w, 401)
 				return
 			}
 
-			// Добавляем пользователя в контекст
-			ctx := context.WithValue(r.Context(), "login", claims["login"])
+			// Добавляем пользователя и сессию в контекст
+			logging.SetLogin(r.Context(), claims.Login)
+			ctx = context.WithValue(r.Context(), "login", claims.Login)
+			ctx = context.WithValue(ctx, "session", claims.SessionID)
+			ctx = context.WithValue(ctx, "role", role)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// allowedByScopes проверяет, что области действия ключа разрешают метод запроса
+func allowedByScopes(method string, scopes []string) bool {
+	required := apikeys.ScopeWrite
+	if method == http.MethodGet || method == http.MethodHead {
+		required = apikeys.ScopeRead
+	}
+	for _, scope := range scopes {
+		if scope == required || scope == apikeys.ScopeWrite {
+			return true
+		}
+	}
+	return false
+}
+
+// activeUserRole возвращает роль пользователя и проверяет, что учетная запись не отключена.
+// Роль не кэшируется, чтобы ее изменение и отключение действовали сразу.
+func activeUserRole(w http.ResponseWriter, r *http.Request, users repository.UserRepository, login string) (string, bool) {
+	account, err := users.Get(r.Context(), login)
+	if err != nil {
+		metrics.AuthFailures.Inc("unknown_user")
+		utils.ErrorResponse(w, 401)
+		return "", false
+	}
+	if account.Disabled {
+		metrics.AuthFailures.Inc("disabled")
+		utils.ErrorResponse(w, 403)
+		return "", false
+	}
+	return account.Role, true
+}
+
+// RequireRole пропускает только пользователей с одной из указанных ролей
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, _ := r.Context().Value("role").(string)
+			for _, allowed := range roles {
+				if role == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			utils.ErrorResponse(w, 403)
+		})
+	}
+}
+
+// DenyReadOnly запрещает пользователям с ролью readonly изменять данные
+func DenyReadOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role, _ := r.Context().Value("role").(string)
+		if role == models.RoleReadOnly && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			utils.ErrorResponse(w, 403)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
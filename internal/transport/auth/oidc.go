@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"cache-web-server/internal/audit"
+	"cache-web-server/internal/metrics"
+	"cache-web-server/internal/oidc"
+	"cache-web-server/internal/repository"
+	"cache-web-server/internal/sessions"
+	"cache-web-server/internal/tokens"
+	"cache-web-server/internal/utils"
+)
+
+// oidcStateTTL сколько ждать возврата пользователя от IdP
+const oidcStateTTL = 10 * time.Minute
+
+// oidcStateCookie cookie, которая привязывает state к браузеру, начавшему вход.
+// Без нее чужой код авторизации, подсунутый по ссылке, залогинил бы жертву
+// под учетной записью атакующего (login CSRF).
+const oidcStateCookie = "oidc_state"
+
+// errNoAccount пользователь IdP не сопоставлен ни с одной учетной записью
+var errNoAccount = errors.New("учетная запись не найдена")
+
+// OIDCLoginHandler перенаправляет пользователя на страницу входа IdP.
+// state, nonce и PKCE code_verifier сохраняются в БД до возврата пользователя,
+// state также кладется в HttpOnly cookie браузера.
+func OIDCLoginHandler(db *sql.DB, provider *oidc.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		var values [3]string
+		for i := range values {
+			value, err := tokens.NewRefreshToken()
+			if err != nil {
+				utils.ServerError(w, r, err)
+				return
+			}
+			values[i] = value
+		}
+		state, nonce, verifier := values[0], values[1], values[2]
+
+		// Попутно удаляем состояния, по которым пользователь так и не вернулся
+		if _, err := db.ExecContext(r.Context(), `DELETE FROM oidc_states WHERE expires_at <= NOW()`); err != nil {
+			slog.WarnContext(r.Context(), "не удалось удалить устаревшие состояния OIDC", "error", err)
+		}
+
+		query := `INSERT INTO oidc_states (state, nonce, verifier, expires_at)
+			VALUES ($1, $2, $3, NOW() + make_interval(secs => $4))`
+		if _, err := db.ExecContext(r.Context(), query, state, nonce, verifier, oidcStateTTL.Seconds()); err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		http.SetCookie(w, stateCookie(provider, state, int(oidcStateTTL.Seconds())))
+		http.Redirect(w, r, authURL, http.StatusFound)
+	}
+}
+
+// OIDCCallbackHandler завершает вход через IdP: обменивает код на ID-токен,
+// сопоставляет пользователя IdP с учетной записью и выпускает собственные токены сервера
+func OIDCCallbackHandler(db *sql.DB, users repository.UserRepository, provider *oidc.Provider, issuer *tokens.Issuer, store *sessions.Store,
+	refreshTTL time.Duration, autoProvision bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		if r.URL.Query().Get("error") != "" {
+			utils.ErrorResponse(w, 401)
+			return
+		}
+
+		code := r.URL.Query().Get("code")
+		state := r.URL.Query().Get("state")
+		if code == "" || state == "" {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		// state должен прийти в тот же браузер, который начал вход
+		cookie, err := r.Cookie(oidcStateCookie)
+		if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+		http.SetCookie(w, stateCookie(provider, "", -1))
+
+		// state одноразовый: удаляем его сразу при чтении
+		var nonce, verifier string
+		query := `DELETE FROM oidc_states WHERE state = $1 AND expires_at > NOW() RETURNING nonce, verifier`
+		err = db.QueryRowContext(r.Context(), query, state).Scan(&nonce, &verifier)
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		claims, err := provider.Exchange(r.Context(), code, verifier, nonce)
+		if err != nil {
+			slog.WarnContext(r.Context(), "ошибка обмена кода OIDC", "error", err)
+			metrics.AuthFailures.Inc("oidc")
+			utils.ErrorResponse(w, 401)
+			return
+		}
+
+		login, err := resolveOIDCUser(r.Context(), users, provider.Issuer(), claims, autoProvision)
+		if errors.Is(err, errNoAccount) {
+			metrics.AuthFailures.Inc("no_account")
+			audit.Record(db, r, "", audit.ActionLoginFailed, claims.Subject, map[string]interface{}{"reason": "no_account", "method": "oidc"})
+			utils.ErrorResponse(w, 403)
+			return
+		}
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		// Как и при входе по паролю, отключенным пользователям и пользователям
+		// с обязательной сменой пароля вход запрещен
+		account, err := users.Get(r.Context(), login)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+		if account.Disabled || account.MustReset {
+			reason := "disabled"
+			if !account.Disabled {
+				reason = "must_reset_password"
+			}
+			loginFailed(db, r, login, "oidc", reason)
+			utils.ErrorResponse(w, 403)
+			return
+		}
+
+		if startSession(w, r, issuer, store, login, refreshTTL) {
+			audit.Record(db, r, login, audit.ActionLogin, login, map[string]interface{}{"method": "oidc"})
+		}
+	}
+}
+
+// stateCookie формирует cookie со state, maxAge < 0 удаляет ее.
+// SameSite=Lax, чтобы cookie пришла при возврате пользователя от IdP.
+func stateCookie(provider *oidc.Provider, state string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(provider.RedirectURL(), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// resolveOIDCUser находит учетную запись пользователя IdP.
+// Сначала ищется привязка по (issuer, sub), затем пользователь с подтвержденным email,
+// заданным при регистрации или администратором, при autoProvision создается новая учетная запись.
+func resolveOIDCUser(ctx context.Context, users repository.UserRepository, issuer string, claims *oidc.IDClaims, autoProvision bool) (string, error) {
+	login, err := users.FindByIdentity(ctx, issuer, claims.Subject)
+	if err == nil {
+		return login, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return "", err
+	}
+
+	// Привязываем по email, только если IdP его подтвердил
+	if claims.Email != "" && claims.EmailVerified {
+		login, err = users.FindByEmail(ctx, claims.Email)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return "", err
+		}
+	}
+
+	if login == "" {
+		if !autoProvision {
+			return "", errNoAccount
+		}
+		return provisionOIDCUser(ctx, users, issuer, claims)
+	}
+
+	if err := users.LinkIdentity(ctx, issuer, claims.Subject, login); err != nil {
+		return "", err
+	}
+	return login, nil
+}
+
+// provisionOIDCUser создает учетную запись для пользователя IdP и привязывает ее к нему.
+// Вход по паролю для нее невозможен, пока администратор не выдаст токен сброса.
+func provisionOIDCUser(ctx context.Context, users repository.UserRepository, issuer string, claims *oidc.IDClaims) (string, error) {
+	password, err := tokens.NewRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return "", err
+	}
+
+	var email string
+	if claims.Email != "" && claims.EmailVerified {
+		email = claims.Email
+	}
+
+	base := oidcLoginBase(claims)
+	for attempt := 0; attempt < 5; attempt++ {
+		login := base
+		if attempt > 0 || len(login) < 8 {
+			login += randomDigits(max(8-len(login), 4))
+		}
+
+		err := users.CreateOIDC(ctx, login, hashedPassword, email, issuer, claims.Subject)
+		if err == nil {
+			return login, nil
+		}
+		if !errors.Is(err, repository.ErrExists) {
+			return "", err
+		}
+	}
+
+	return "", errors.New("не удалось подобрать свободный логин")
+}
+
+// oidcLoginBase основа логина из preferred_username или email, только латинские буквы и цифры
+func oidcLoginBase(claims *oidc.IDClaims) string {
+	source := claims.PreferredUsername
+	if source == "" {
+		source, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	var b strings.Builder
+	for _, r := range source {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return "user"
+	}
+	return b.String()
+}
+
+// randomDigits возвращает n случайных цифр
+func randomDigits(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		d, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			d = big.NewInt(0)
+		}
+		b.WriteByte(byte('0' + d.Int64()))
+	}
+	return b.String()
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/oidc"
+	"cache-web-server/internal/repository/memory"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	provider := oidc.NewProvider(oidc.Config{RedirectURL: "https://cache.example.com/api/auth/oidc/callback"}, nil)
+	// До проверки cookie обработчик не обращается ни к БД, ни к IdP
+	handler := OIDCCallbackHandler(nil, nil, provider, nil, nil, 0, false)
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+	}{
+		{name: "без cookie"},
+		{name: "state другого браузера", cookie: &http.Cookie{Name: oidcStateCookie, Value: "victim-state"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?code=attacker-code&state=attacker-state", nil)
+			if tt.cookie != nil {
+				r.AddCookie(tt.cookie)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("статус %d, ожидался 400", w.Code)
+			}
+		})
+	}
+}
+
+func TestStateCookie(t *testing.T) {
+	provider := oidc.NewProvider(oidc.Config{RedirectURL: "https://cache.example.com/api/auth/oidc/callback"}, nil)
+
+	cookie := stateCookie(provider, "state", 600)
+	if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("небезопасная cookie: %+v", cookie)
+	}
+
+	provider = oidc.NewProvider(oidc.Config{RedirectURL: "http://localhost:8080/api/auth/oidc/callback"}, nil)
+	if stateCookie(provider, "state", 600).Secure {
+		t.Fatal("cookie с Secure не вернется на http-адрес")
+	}
+}
+
+func TestResolveOIDCUser(t *testing.T) {
+	ctx := context.Background()
+	users := memory.NewUsers(memory.NewDocuments())
+	if err := users.Create(ctx, "alice", "hash", models.RoleUser, "Alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	const issuer = "https://idp.example.com"
+
+	// Неподтвержденный email не привязывает чужую учетную запись
+	claims := &oidc.IDClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "sub-1"}, Email: "alice@example.com"}
+	if _, err := resolveOIDCUser(ctx, users, issuer, claims, false); !errors.Is(err, errNoAccount) {
+		t.Fatalf("неподтвержденный email: ошибка %v", err)
+	}
+
+	claims.EmailVerified = true
+	if login, err := resolveOIDCUser(ctx, users, issuer, claims, false); err != nil || login != "alice" {
+		t.Fatalf("вход по email: %q, ошибка %v", login, err)
+	}
+	// Дальше учетная запись находится по привязке, даже если email у IdP сменился
+	claims.Email = "alice@other.example.com"
+	if login, err := resolveOIDCUser(ctx, users, issuer, claims, false); err != nil || login != "alice" {
+		t.Fatalf("вход по привязке: %q, ошибка %v", login, err)
+	}
+
+	// Новый пользователь IdP получает учетную запись, логин alice уже занят
+	claims = &oidc.IDClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "sub-2"}, PreferredUsername: "alice", Email: "new@example.com", EmailVerified: true}
+	login, err := resolveOIDCUser(ctx, users, issuer, claims, true)
+	if err != nil || login == "alice" {
+		t.Fatalf("создание учетной записи: %q, ошибка %v", login, err)
+	}
+	account, err := users.Get(ctx, login)
+	if err != nil || account.Role != models.RoleUser || account.Email != "new@example.com" {
+		t.Fatalf("созданная учетная запись %+v, ошибка %v", account, err)
+	}
+	if again, err := resolveOIDCUser(ctx, users, issuer, claims, true); err != nil || again != login {
+		t.Fatalf("повторный вход: %q, ошибка %v", again, err)
+	}
+}
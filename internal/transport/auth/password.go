@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cache-web-server/internal/audit"
+	"cache-web-server/internal/loginguard"
+	"cache-web-server/internal/metrics"
+	"cache-web-server/internal/repository"
+	"cache-web-server/internal/sessions"
+	"cache-web-server/internal/tokens"
+	"cache-web-server/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// changePasswordRequest тело запроса на смену пароля
+type changePasswordRequest struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// resetPasswordRequest тело запроса на сброс пароля по токену
+type resetPasswordRequest struct {
+	Login string `json:"login"`
+	Token string `json:"token"`
+	New   string `json:"new"`
+}
+
+// ChangePasswordHandler меняет пароль текущего пользователя.
+// Требует старый пароль, все остальные сессии пользователя отзываются.
+// Неверный старый пароль учитывается в счетчике попыток входа.
+func ChangePasswordHandler(users repository.UserRepository, store *sessions.Store, guard *loginguard.Guard, auditLog audit.Execer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		if !hasSession(r) {
+			utils.ErrorResponse(w, 403)
+			return
+		}
+
+		login := r.Context().Value("login").(string)
+		sessionID := r.Context().Value("session").(string)
+
+		var req changePasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+		if !validPass(req.New) {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		// Подбор старого пароля ограничивается так же, как вход: иначе украденный
+		// access-токен позволял бы перебирать текущий пароль без ограничений
+		ip := utils.ClientIP(r)
+		retryAfter, err := guard.Check(r.Context(), login, ip)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+		if retryAfter > 0 {
+			loginFailed(auditLog, r, login, "change_password", "locked")
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			utils.ErrorResponse(w, 429)
+			return
+		}
+
+		// Проверяем старый пароль
+		account, err := users.Get(r.Context(), login)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(req.Old)); err != nil {
+			if err := guard.Fail(r.Context(), login, ip); err != nil {
+				slog.ErrorContext(r.Context(), "не удалось учесть неудачный вход", "error", err)
+			}
+			loginFailed(auditLog, r, login, "change_password", "credentials")
+			utils.ErrorResponse(w, 401)
+			return
+		}
+		if err := guard.Succeed(r.Context(), login); err != nil {
+			slog.ErrorContext(r.Context(), "не удалось сбросить счетчик входов", "error", err)
+		}
+
+		hashedPassword, err := hashPassword(req.New)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+		if err := users.SetPassword(r.Context(), login, hashedPassword); err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		// Оставляем активной только текущую сессию
+		if err := store.RevokeAll(r.Context(), login, sessionID); err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		audit.Record(auditLog, r, login, audit.ActionPasswordChange, login, nil)
+
+		utils.ActResponse(w, "login", login)
+	}
+}
+
+// IssueResetTokenHandler выпускает одноразовый токен сброса пароля пользователя.
+// Токен выдается администратору, пользователь до сброса не может войти.
+func IssueResetTokenHandler(users repository.UserRepository, store *sessions.Store, auditLog audit.Execer, ttl time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		login := chi.URLParam(r, "login")
+		admin := r.Context().Value("login").(string)
+
+		token, err := tokens.NewRefreshToken()
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		// Помечаем пользователя и делаем недействительными прежние токены сброса
+		err = users.IssueResetToken(r.Context(), login, sessions.HashToken(token), admin, ttl)
+		if errors.Is(err, repository.ErrNotFound) {
+			utils.ErrorResponse(w, 404)
+			return
+		}
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		if err := store.RevokeAll(r.Context(), login, ""); err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		audit.Record(auditLog, r, admin, audit.ActionResetTokenIssue, login, map[string]interface{}{"ttl": ttl.String()})
+
+		utils.ActResponse(w, "reset_token", token)
+	}
+}
+
+// ResetPasswordHandler устанавливает новый пароль по одноразовому токену сброса
+func ResetPasswordHandler(users repository.UserRepository, store *sessions.Store, auditLog audit.Execer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		var req resetPasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Login == "" || req.Token == "" {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+		if !validPass(req.New) {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		hashedPassword, err := hashPassword(req.New)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		// Гасим токен, одновременно проверяя срок действия и владельца
+		err = users.ResetPassword(r.Context(), req.Login, sessions.HashToken(req.Token), hashedPassword)
+		if errors.Is(err, repository.ErrNotFound) {
+			metrics.AuthFailures.Inc("reset_token")
+			audit.Record(auditLog, r, req.Login, audit.ActionLoginFailed, req.Login, map[string]interface{}{"reason": "credentials", "method": "reset_token"})
+			utils.ErrorResponse(w, 401)
+			return
+		}
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		if err := store.RevokeAll(r.Context(), req.Login, ""); err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		audit.Record(auditLog, r, req.Login, audit.ActionPasswordReset, req.Login, nil)
+
+		utils.ActResponse(w, "login", req.Login)
+	}
+}
@@ -0,0 +1,63 @@
+package transport
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"log/slog"
+	"math"
+	"net/http"
+	"time"
+
+	"cache-web-server/internal/metrics"
+	"cache-web-server/internal/sessions"
+	"cache-web-server/internal/utils"
+)
+
+// registerMetrics регистрирует метрики пула БД и хранилища сессий
+func registerMetrics(db *sql.DB, store *sessions.Store, refreshTTL time.Duration) {
+	metrics.RegisterDBStats(db)
+
+	metrics.NewCounterFunc("session_cache_hits_total", "Проверки сессий, найденные в кэше.", func() float64 {
+		hits, _ := store.CacheStats()
+		return float64(hits)
+	})
+	metrics.NewCounterFunc("session_cache_misses_total", "Проверки сессий, ушедшие в БД.", func() float64 {
+		_, misses := store.CacheStats()
+		return float64(misses)
+	})
+	metrics.NewGaugeFunc("session_cache_hit_ratio", "Доля проверок сессий, найденных в кэше.", func() float64 {
+		hits, misses := store.CacheStats()
+		if hits+misses == 0 {
+			return 0
+		}
+		return float64(hits) / float64(hits+misses)
+	})
+
+	// Сессия считается активной, пока ее refresh-токен может быть действителен
+	metrics.NewGaugeFunc("sessions_active", "Неотозванные сессии, использованные за время жизни refresh-токена.", func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		n, err := store.CountActive(ctx, refreshTTL)
+		if err != nil {
+			slog.Error("ошибка при подсчете активных сессий", "error", err)
+			return math.NaN()
+		}
+		return float64(n)
+	})
+}
+
+// metricsHandler отдает метрики, при непустом token требует заголовок Authorization: Bearer <token>
+func metricsHandler(token string) http.HandlerFunc {
+	handler := metrics.Default.Handler()
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			got := []byte(r.Header.Get("Authorization"))
+			if subtle.ConstantTimeCompare(got, []byte("Bearer "+token)) != 1 {
+				utils.ErrorResponse(w, 401)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,54 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/repository"
+	"cache-web-server/internal/utils"
+)
+
+// requireAccess проверяет, что у пользователя есть требуемый уровень доступа к документу,
+// и при его отсутствии сам пишет ответ с ошибкой
+func requireAccess(w http.ResponseWriter, r *http.Request, docs repository.DocumentRepository, id, login string, required models.Permission) bool {
+	perm, err := docs.Access(r.Context(), id, login, false)
+	return checkPermission(w, r, perm, err, required)
+}
+
+// requireTrashAccess аналог requireAccess для документов в корзине
+func requireTrashAccess(w http.ResponseWriter, r *http.Request, docs repository.DocumentRepository, id, login string, required models.Permission) bool {
+	perm, err := docs.Access(r.Context(), id, login, true)
+	return checkPermission(w, r, perm, err, required)
+}
+
+// checkPermission пишет ответ с ошибкой, если доступ не получен
+func checkPermission(w http.ResponseWriter, r *http.Request, perm models.Permission, err error, required models.Permission) bool {
+	if errors.Is(err, repository.ErrNotFound) {
+		utils.ErrorResponse(w, 404)
+		return false
+	}
+	if errors.Is(err, repository.ErrExpired) {
+		utils.ErrorResponse(w, 410)
+		return false
+	}
+	if err != nil {
+		utils.ServerError(w, r, err)
+		return false
+	}
+	if !perm.Allows(required) {
+		utils.ErrorResponse(w, 403)
+		return false
+	}
+	return true
+}
+
+// validGrants проверяет, что все уровни доступа допустимы
+func validGrants(grants map[string]models.Permission) bool {
+	for _, perm := range grants {
+		if !perm.Valid() {
+			return false
+		}
+	}
+	return true
+}
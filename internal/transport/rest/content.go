@@ -0,0 +1,35 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"cache-web-server/internal/tracing"
+)
+
+// readContent читает содержимое документа из тела запроса.
+// Время чтения попадает в трассу отдельным спаном.
+func readContent(ctx context.Context, src io.Reader) ([]byte, error) {
+	_, span := tracing.StartChild(ctx, "document.read", tracing.KindInternal)
+	defer span.End()
+
+	content, err := io.ReadAll(src)
+	span.SetAttr("document.size", len(content))
+	span.RecordError(err)
+	return content, err
+}
+
+// writeContent отправляет содержимое документа клиенту.
+// Время отправки попадает в трассу отдельным спаном.
+func writeContent(w http.ResponseWriter, r *http.Request, content []byte) {
+	_, span := tracing.StartChild(r.Context(), "document.write", tracing.KindInternal)
+	defer span.End()
+
+	span.SetAttr("document.size", len(content))
+	if _, err := w.Write(content); err != nil {
+		span.RecordError(err)
+		slog.WarnContext(r.Context(), "не удалось отправить содержимое документа", "error", err)
+	}
+}
@@ -0,0 +1,359 @@
+package rest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"cache-web-server/internal/audit"
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/repository"
+	"cache-web-server/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// groupName допустимый формат имени группы
+var groupName = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+
+// groupRequest тело запроса на создание группы и добавление участников
+type groupRequest struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+// queryer общий интерфейс для *sql.DB и *sql.Tx
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// loadGroup читает группу вместе с участниками
+func loadGroup(ctx context.Context, db queryer, name string) (models.Group, error) {
+	group := models.Group{Name: name, Members: []string{}}
+	var owner sql.NullString
+	query := `SELECT owner, created FROM groups WHERE name = $1`
+	if err := db.QueryRowContext(ctx, query, name).Scan(&owner, &group.Created); err != nil {
+		return group, err
+	}
+	group.Owner = owner.String
+
+	rows, err := db.QueryContext(ctx, `SELECT login FROM group_members WHERE group_name = $1 ORDER BY login`, name)
+	if err != nil {
+		return group, fmt.Errorf("ошибка при чтении участников группы: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var login string
+		if err := rows.Scan(&login); err != nil {
+			return group, fmt.Errorf("ошибка при чтении участников группы: %w", err)
+		}
+		group.Members = append(group.Members, login)
+	}
+	return group, rows.Err()
+}
+
+// requireGroup читает группу и проверяет, что пользователь может ее видеть
+// (manage = false) или изменять (manage = true). При ошибке сам пишет ответ.
+func requireGroup(w http.ResponseWriter, r *http.Request, db queryer, manage bool) (models.Group, bool) {
+	login := r.Context().Value("login").(string)
+	role, _ := r.Context().Value("role").(string)
+
+	group, err := loadGroup(r.Context(), db, chi.URLParam(r, "name"))
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.ErrorResponse(w, 404)
+		return group, false
+	}
+	if err != nil {
+		utils.ServerError(w, r, err)
+		return group, false
+	}
+
+	// Группой управляют владелец и администраторы, видят ее также участники
+	member := containsString(group.Members, login)
+	if role == models.RoleAdmin || group.Owner == login || (!manage && member) {
+		return group, true
+	}
+
+	// Существование чужих групп не раскрываем
+	if member {
+		utils.ErrorResponse(w, 403)
+	} else {
+		utils.ErrorResponse(w, 404)
+	}
+	return group, false
+}
+
+// addMembers добавляет пользователей в группу, возвращает false, если кого-то из них нет
+func addMembers(ctx context.Context, db queryer, users repository.UserRepository, name string, logins []string) (bool, error) {
+	query := `INSERT INTO group_members (group_name, login) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	for _, login := range logins {
+		exists, err := users.Exists(ctx, login)
+		if err != nil {
+			return false, err
+		}
+		if !exists {
+			return false, nil
+		}
+		if _, err := db.ExecContext(ctx, query, name, login); err != nil {
+			return false, fmt.Errorf("ошибка при добавлении участника: %w", err)
+		}
+	}
+	return true, nil
+}
+
+// CreateGroupHandler создает группу, владельцем становится текущий пользователь
+func CreateGroupHandler(db *sql.DB, users repository.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		login := r.Context().Value("login").(string)
+
+		var req groupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !groupName.MatchString(req.Name) {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		tx, err := db.BeginTx(r.Context(), nil)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+		defer tx.Rollback()
+
+		result, err := tx.ExecContext(r.Context(), `INSERT INTO groups (name, owner) VALUES ($1, $2) ON CONFLICT DO NOTHING`, req.Name, login)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			utils.ErrorResponse(w, 409)
+			return
+		}
+
+		ok, err := addMembers(r.Context(), tx, users, req.Name, req.Members)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+		if !ok {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		group, err := loadGroup(r.Context(), tx, req.Name)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		audit.Record(db, r, login, audit.ActionGroupCreate, group.Name, map[string]interface{}{"members": group.Members})
+
+		utils.ActResponse(w, "group", group)
+	}
+}
+
+// ListGroupsHandler возвращает группы, которыми пользователь владеет или в которых состоит.
+// Администраторам возвращаются все группы.
+func ListGroupsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		login := r.Context().Value("login").(string)
+		role, _ := r.Context().Value("role").(string)
+
+		query := `SELECT g.name, COALESCE(g.owner, ''), g.created,
+				COALESCE((SELECT array_to_string(array_agg(m.login ORDER BY m.login), ',')
+					FROM group_members m WHERE m.group_name = g.name), '')
+			FROM groups g
+			WHERE $2 OR g.owner = $1 OR EXISTS (SELECT 1 FROM group_members m WHERE m.group_name = g.name AND m.login = $1)
+			ORDER BY g.name`
+		rows, err := db.QueryContext(r.Context(), query, login, role == models.RoleAdmin)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+		defer rows.Close()
+
+		groups := []models.Group{}
+		for rows.Next() {
+			var g models.Group
+			var members string
+			if err := rows.Scan(&g.Name, &g.Owner, &g.Created, &members); err != nil {
+				utils.ServerError(w, r, err)
+				return
+			}
+			g.Members = []string{}
+			if members != "" {
+				g.Members = strings.Split(members, ",")
+			}
+			groups = append(groups, g)
+		}
+		if err := rows.Err(); err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		utils.ActResponse(w, "groups", groups)
+	}
+}
+
+// GetGroupHandler возвращает группу с участниками
+func GetGroupHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		group, ok := requireGroup(w, r, db, false)
+		if !ok {
+			return
+		}
+
+		utils.ActResponse(w, "group", group)
+	}
+}
+
+// AddMembersHandler добавляет пользователей в группу
+func AddMembersHandler(db *sql.DB, users repository.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		var req groupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Members) == 0 {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		tx, err := db.BeginTx(r.Context(), nil)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+		defer tx.Rollback()
+
+		group, ok := requireGroup(w, r, tx, true)
+		if !ok {
+			return
+		}
+
+		ok, err = addMembers(r.Context(), tx, users, group.Name, req.Members)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+		if !ok {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		login := r.Context().Value("login").(string)
+		audit.Record(db, r, login, audit.ActionGroupMembers, group.Name, map[string]interface{}{"added": req.Members})
+
+		utils.ActResponse(w, group.Name, true)
+	}
+}
+
+// RemoveMemberHandler удаляет пользователя из группы.
+// Участник может выйти из группы сам.
+func RemoveMemberHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		login := r.Context().Value("login").(string)
+		member := chi.URLParam(r, "login")
+
+		group, ok := requireGroup(w, r, db, member != login)
+		if !ok {
+			return
+		}
+
+		result, err := db.ExecContext(r.Context(), `DELETE FROM group_members WHERE group_name = $1 AND login = $2`, group.Name, member)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			utils.ErrorResponse(w, 404)
+			return
+		}
+
+		audit.Record(db, r, login, audit.ActionGroupMembers, group.Name, map[string]interface{}{"removed": []string{member}})
+
+		utils.ActResponse(w, member, true)
+	}
+}
+
+// DeleteGroupHandler удаляет группу вместе с выданными ей правами на документы
+func DeleteGroupHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		tx, err := db.BeginTx(r.Context(), nil)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+		defer tx.Rollback()
+
+		group, ok := requireGroup(w, r, tx, true)
+		if !ok {
+			return
+		}
+
+		queries := []string{
+			`DELETE FROM document_grants WHERE login = $1`,
+			`DELETE FROM groups WHERE name = $1`,
+		}
+		args := []string{models.GroupPrefix + group.Name, group.Name}
+		for i, query := range queries {
+			if _, err := tx.ExecContext(r.Context(), query, args[i]); err != nil {
+				utils.ServerError(w, r, err)
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		login := r.Context().Value("login").(string)
+		audit.Record(db, r, login, audit.ActionGroupDelete, group.Name, map[string]interface{}{"members": group.Members})
+
+		utils.ActResponse(w, group.Name, true)
+	}
+}
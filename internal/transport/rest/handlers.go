@@ -1,23 +1,26 @@
 package rest
 
 import (
-	"database/sql"
 	"encoding/json"
-	"fmt"
-	"io"
-	"log"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"cache-web-server/internal/audit"
 	"cache-web-server/internal/models"
+	"cache-web-server/internal/repository"
+	"cache-web-server/internal/sessions"
 	"cache-web-server/internal/utils"
 
 	"github.com/go-chi/chi/v5"
 )
 
-// UploadHandler обрабатывает загрузку нового документа
-func UploadHandler(db *sql.DB) http.HandlerFunc {
+// UploadHandler обрабатывает загрузку нового документа.
+// Token документа в корзине или с истекшим, но еще не удаленным сроком хранения
+// остается занятым: загрузка отвечает 409, пока документ не удален окончательно.
+func UploadHandler(docs repository.DocumentRepository, auditLog audit.Execer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			utils.ErrorResponse(w, 405)
@@ -61,8 +64,22 @@ func UploadHandler(db *sql.DB) http.HandlerFunc {
 			}
 		}
 
-		var docID string
+		// Вычисляем срок хранения
+		expiresAt, err := meta.ExpiresAt(time.Now())
+		if err != nil {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		// Проверяем права доступа
+		grants := meta.Grants()
+		if !validGrants(grants) {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
 		// Достаем файл
+		var fileData []byte
 		if meta.File {
 			file, _, err := r.FormFile("file")
 			if err != nil {
@@ -72,40 +89,58 @@ func UploadHandler(db *sql.DB) http.HandlerFunc {
 			defer file.Close()
 
 			// Читаем содержимое файла в память
-			fileData, err := io.ReadAll(file)
+			fileData, err = readContent(r.Context(), file)
 			if err != nil {
-				utils.ErrorResponse(w, 500)
+				utils.ServerError(w, r, err)
 				return
 			}
+		}
 
-			// Вставляем данные в таблицу
-			query := `INSERT INTO documents (id, name, mime, has_file, public, grant_login, owner, file)
-				  VALUES ($1, $2, $3, TRUE, $4, $5, $6, $7) RETURNING id`
-			err = db.QueryRow(query, meta.Token, meta.Name, meta.Mime, meta.Public, meta.Grant, login, fileData).Scan(&docID)
-			if err != nil {
-				fmt.Println(err)
-				utils.ErrorResponse(w, 500)
-				return
-			}
+		// Сохраняем документ вместе с правами доступа и первой версией
+		err = docs.Create(r.Context(), repository.NewDocument{
+			ID:      meta.Token,
+			Name:    meta.Name,
+			Mime:    meta.Mime,
+			File:    meta.File,
+			Public:  meta.Public,
+			Owner:   login,
+			Content: fileData,
+			Expires: expiresAt,
+			Access:  grants,
+		})
+		if errors.Is(err, repository.ErrExists) {
+			utils.ErrorMessage(w, 409, "Документ с таким token уже существует")
+			return
+		}
+		if errors.Is(err, repository.ErrTrashed) {
+			utils.ErrorMessage(w, 409, "Документ с таким token находится в корзине: восстановите его или удалите окончательно")
+			return
+		}
+		if errors.Is(err, repository.ErrExpired) {
+			utils.ErrorMessage(w, 409, "Срок хранения документа с таким token истек, token освободится после его удаления")
+			return
+		}
+		if errors.Is(err, repository.ErrUnknownGroup) {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
 
-			utils.UploadResponse(w, jsonParsed, meta.Name)
-		} else {
-			query := `INSERT INTO documents (id, name, mime, has_file, public, grant_login, owner)
-				  VALUES ($1, $2, $3, TRUE, $4, $5, $6) RETURNING id`
-			err := db.QueryRow(query, meta.Token, meta.Name, meta.Mime, meta.Public, meta.Grant, login).Scan(&docID)
-			if err != nil {
-				fmt.Println(err)
-				utils.ErrorResponse(w, 500)
-				return
-			}
+		audit.Record(auditLog, r, login, audit.ActionUpload, meta.Token, map[string]interface{}{
+			"name":   meta.Name,
+			"public": meta.Public,
+			"access": grants,
+		})
 
-			utils.UploadResponse(w, jsonParsed, meta.Name)
-		}
+		utils.UploadResponse(w, jsonParsed, meta.Name)
 	}
 }
 
 // ListDocsHandler обрабатывает получение списка документов
-func ListDocsHandler(db *sql.DB) http.HandlerFunc {
+func ListDocsHandler(docs repository.DocumentRepository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet && r.Method != http.MethodHead {
 			utils.ErrorResponse(w, 405)
@@ -121,28 +156,19 @@ func ListDocsHandler(db *sql.DB) http.HandlerFunc {
 		value := r.URL.Query().Get("value")
 		limitStr := r.URL.Query().Get("limit")
 
-		// Составляем базовый SQL-запрос для получения документов
-		query := `SELECT id, name, mime, has_file, public, created, grant_login FROM documents`
-		shardQuery := []string{}
-		params := []interface{}{}
-
-		// Если передан логин, фильтруем документы по нему, иначе показываем только свои
+		// Если передан логин, показываем доступные нам документы этого пользователя, иначе только свои
+		filter := repository.DocumentFilter{Owner: userLogin, Viewer: userLogin}
 		if login != "" {
-			shardQuery = append(shardQuery, fmt.Sprintf("login = $%d", len(params)+1))
-			params = append(params, login)
-		} else {
-			shardQuery = append(shardQuery, fmt.Sprintf("owner = $%d", len(params)+1))
-			params = append(params, userLogin)
+			filter.Owner = login
 		}
 
 		// Если передан параметр key и value, добавляем фильтрацию по ним
 		if key != "" && value != "" {
-			shardQuery = append(shardQuery, fmt.Sprintf("%s = $%d", key, len(params)+1))
-			params = append(params, value)
-		}
-
-		if len(shardQuery) > 0 {
-			query += " WHERE " + strings.Join(shardQuery, " AND ") + " ORDER BY name, created"
+			if !containsString(repository.FilterFields, key) {
+				utils.ErrorResponse(w, 400)
+				return
+			}
+			filter.Field, filter.Value = key, value
 		}
 
 		if limitStr != "" {
@@ -151,39 +177,21 @@ func ListDocsHandler(db *sql.DB) http.HandlerFunc {
 				utils.ErrorResponse(w, 400) // Неверный лимит
 				return
 			}
-			query += " LIMIT $" + strconv.Itoa(len(params)+1)
-			params = append(params, limit)
+			filter.Limit = limit
 		}
 
-		// Выполняем запрос к базе данных
-		rows, err := db.Query(query, params...)
+		list, err := docs.List(r.Context(), filter)
 		if err != nil {
-			utils.ErrorResponse(w, 500)
+			utils.ServerError(w, r, err)
 			return
 		}
-		defer rows.Close()
 
-		var docs []models.Document
-		// Читаем строки из результата запроса
-		for rows.Next() {
-			var doc models.Document
-			var grant string
-			if err := rows.Scan(&doc.ID, &doc.Name, &doc.Mime, &doc.File, &doc.Public, &doc.Created, &grant); err != nil {
-				fmt.Println(err)
-				utils.ErrorResponse(w, 500)
-				return
-			}
-
-			doc.Grant = strings.Split(grant, ",")
-			docs = append(docs, doc)
-		}
-
-		utils.DataResponse(w, docs)
+		utils.DataResponse(w, list)
 	}
 }
 
 // GetDocHandler обрабатывает получение одного документа
-func GetDocHandler(db *sql.DB) http.HandlerFunc {
+func GetDocHandler(docs repository.DocumentRepository, auditLog audit.Execer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet && r.Method != http.MethodHead {
 			utils.ErrorResponse(w, 405)
@@ -197,31 +205,36 @@ func GetDocHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Читаем документ из базы
-		query := `SELECT id, name, mime, has_file, public, created, grant_login, file FROM documents WHERE id = $1`
-		var doc models.Document
-		var file []byte
-		var grant string
-		err := db.QueryRow(query, id).Scan(&doc.ID, &doc.Name, &doc.Mime, &doc.File, &doc.Public, &doc.Created, &grant, &file)
+		// Извлекаем логин текущего пользователя из контекста
+		login := r.Context().Value("login").(string)
+
+		// Проверяем права на чтение
+		if !requireAccess(w, r, docs, id, login, models.PermRead) {
+			return
+		}
+
+		// Читаем документ
+		doc, file, err := docs.Get(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			utils.ErrorResponse(w, 404)
+			return
+		}
 		if err != nil {
-			fmt.Println(err)
-			utils.ErrorResponse(w, 400)
+			utils.ServerError(w, r, err)
 			return
 		}
-		doc.Grant = strings.Split(grant, ",")
 
 		w.Header().Set("Content-Type", doc.Mime)
+		w.Header().Set("ETag", etag(doc.Version))
 		if r.Method == http.MethodHead {
 			w.WriteHeader(http.StatusOK)
 			return
 		}
 
+		audit.Record(auditLog, r, login, audit.ActionDownload, id, nil)
+
 		if doc.File {
-			w.Write(file)
-			_, err = w.Write(file)
-			if err != nil {
-				log.Fatal(err)
-			}
+			writeContent(w, r, file)
 		} else {
 			utils.DataResponse(w, []models.Document{doc})
 		}
@@ -229,8 +242,9 @@ func GetDocHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-// DeleteDocHandler обрабатывает удаление документа
-func DeleteDocHandler(db *sql.DB) http.HandlerFunc {
+// DeleteDocHandler перемещает документ в корзину владельца.
+// Удалять документ может только владелец или пользователь с правом manage.
+func DeleteDocHandler(docs repository.DocumentRepository, auditLog audit.Execer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Проверяем метод запроса
 		if r.Method != http.MethodDelete {
@@ -241,20 +255,34 @@ func DeleteDocHandler(db *sql.DB) http.HandlerFunc {
 		// Получаем ID документа из параметров
 		id := chi.URLParam(r, "id")
 
-		// Удаляем документ из базы
-		query := `DELETE FROM documents WHERE id = $1`
-		_, err := db.Exec(query, id)
+		// Извлекаем логин текущего пользователя из контекста
+		login := r.Context().Value("login").(string)
+
+		// Проверяем права на удаление
+		if !requireAccess(w, r, docs, id, login, models.PermManage) {
+			return
+		}
+
+		// Помечаем документ удаленным
+		err := docs.Trash(r.Context(), id, login)
+		if errors.Is(err, repository.ErrNotFound) {
+			utils.ErrorResponse(w, 404)
+			return
+		}
 		if err != nil {
-			utils.ErrorResponse(w, 500)
+			utils.ServerError(w, r, err)
 			return
 		}
 
+		audit.Record(auditLog, r, login, audit.ActionDelete, id, nil)
+
 		utils.ActResponse(w, id, true)
 	}
 }
 
-// LogoutHandler завершает сессию пользователя
-func LogoutHandler(db *sql.DB) http.HandlerFunc {
+// LogoutHandler завершает сессию пользователя.
+// Отзывается только сессия предъявленного токена, остальные сессии остаются активными.
+func LogoutHandler(auditLog audit.Execer, store *sessions.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Проверяем метод запроса
 		if r.Method != http.MethodDelete {
@@ -262,15 +290,33 @@ func LogoutHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Получаем токен из параметров
+		// Получаем токен из параметров, он должен совпадать с предъявленным
 		token := chi.URLParam(r, "token")
+		if token != strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			utils.ErrorResponse(w, 403)
+			return
+		}
+
+		// Извлекаем логин и сессию текущего пользователя из контекста
+		login := r.Context().Value("login").(string)
+		sessionID, _ := r.Context().Value("session").(string)
+		if sessionID == "" {
+			utils.ErrorResponse(w, 403)
+			return
+		}
 
-		// Очищаем токен в базе
-		query := `UPDATE users SET token = NULL WHERE token = $1`
-		if _, err := db.Exec(query, token); err != nil {
-			utils.ErrorResponse(w, 500)
+		// Отзываем сессию токена
+		err := store.Revoke(r.Context(), sessionID, login)
+		if errors.Is(err, sessions.ErrNotFound) {
+			utils.ErrorResponse(w, 404)
 			return
 		}
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		audit.Record(auditLog, r, login, audit.ActionLogout, login, map[string]interface{}{"session": sessionID})
 
 		utils.ActResponse(w, token, true)
 	}
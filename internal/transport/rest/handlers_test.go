@@ -0,0 +1,251 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cache-web-server/internal/audit/audittest"
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/repository"
+	"cache-web-server/internal/repository/memory"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// serve выполняет запрос к обработчику от имени login, pattern задает параметры маршрута
+func serve(h http.HandlerFunc, pattern, login string, r *http.Request) *httptest.ResponseRecorder {
+	router := chi.NewRouter()
+	router.HandleFunc(pattern, h)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "login", login)))
+	return w
+}
+
+// upload загружает документ от имени login
+func upload(t *testing.T, docs repository.DocumentRepository, log *audittest.Recorder, login string, meta models.Meta, content string) *httptest.ResponseRecorder {
+	t.Helper()
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("meta", string(metaJSON))
+	if meta.File {
+		part, _ := form.CreateFormFile("file", meta.Name)
+		io.WriteString(part, content)
+	}
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/api/docs", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	return serve(UploadHandler(docs, log), "/api/docs", login, r)
+}
+
+// errorText возвращает текст ошибки из ответа
+func errorText(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp models.APIResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Error == nil {
+		t.Fatalf("в ответе нет ошибки: %v", err)
+	}
+	return resp.Error.Text
+}
+
+func TestUploadConflicts(t *testing.T) {
+	docs := memory.NewDocuments()
+	log := &audittest.Recorder{}
+	meta := models.Meta{Token: "report", Name: "report.txt", File: true, Mime: "text/plain"}
+
+	if w := upload(t, docs, log, "alice", meta, "v1"); w.Code != http.StatusOK {
+		t.Fatalf("загрузка: статус %d", w.Code)
+	}
+	if w := upload(t, docs, log, "bob", meta, "v1"); w.Code != http.StatusConflict {
+		t.Fatalf("повторная загрузка: статус %d, ожидался 409", w.Code)
+	}
+
+	// Token документа в корзине остается занятым
+	if err := docs.Trash(context.Background(), "report", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	w := upload(t, docs, log, "alice", meta, "v2")
+	if w.Code != http.StatusConflict || !strings.Contains(errorText(t, w), "корзин") {
+		t.Fatalf("загрузка поверх корзины: статус %d", w.Code)
+	}
+
+	// Как и token документа с истекшим сроком хранения
+	expired := time.Now().Add(-time.Hour)
+	err := docs.Create(context.Background(), repository.NewDocument{ID: "old", Name: "old.txt", Owner: "alice", Expires: &expired})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = upload(t, docs, log, "alice", models.Meta{Token: "old", Name: "old.txt"}, "")
+	if w.Code != http.StatusConflict || !strings.Contains(errorText(t, w), "истек") {
+		t.Fatalf("загрузка поверх истекшего документа: статус %d", w.Code)
+	}
+
+	if got := strings.Join(log.Actions(), ","); got != "doc.upload" {
+		t.Fatalf("журнал аудита: %s", got)
+	}
+}
+
+func TestDocumentAccess(t *testing.T) {
+	docs := memory.NewDocuments()
+	log := &audittest.Recorder{}
+	meta := models.Meta{Token: "plan", Name: "plan.txt", File: true, Access: map[string]models.Permission{"bob": models.PermRead}}
+	if w := upload(t, docs, log, "alice", meta, "secret"); w.Code != http.StatusOK {
+		t.Fatalf("загрузка: статус %d", w.Code)
+	}
+	expired := time.Now().Add(-time.Hour)
+	if err := docs.Create(context.Background(), repository.NewDocument{ID: "old", Name: "old.txt", Owner: "alice", Expires: &expired}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		id      string
+		login   string
+		want    int
+	}{
+		{name: "владелец читает", handler: GetDocHandler(docs, log), method: http.MethodGet, id: "plan", login: "alice", want: 200},
+		{name: "чтение по праву read", handler: GetDocHandler(docs, log), method: http.MethodGet, id: "plan", login: "bob", want: 200},
+		{name: "чтение без прав", handler: GetDocHandler(docs, log), method: http.MethodGet, id: "plan", login: "carol", want: 403},
+		{name: "удаление с правом read", handler: DeleteDocHandler(docs, log), method: http.MethodDelete, id: "plan", login: "bob", want: 403},
+		{name: "несуществующий документ", handler: GetDocHandler(docs, log), method: http.MethodGet, id: "missing", login: "alice", want: 404},
+		{name: "истекший документ", handler: GetDocHandler(docs, log), method: http.MethodGet, id: "old", login: "alice", want: 410},
+		{name: "неверный метод", handler: GetDocHandler(docs, log), method: http.MethodPost, id: "plan", login: "alice", want: 405},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.handler, "/api/docs/{id}", tt.login, httptest.NewRequest(tt.method, "/api/docs/"+tt.id, nil))
+			if w.Code != tt.want {
+				t.Fatalf("статус %d, ожидался %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+// put заменяет содержимое документа с заголовком If-Match
+func put(docs repository.DocumentRepository, log *audittest.Recorder, id, login, ifMatch, content string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPut, "/api/docs/"+id, strings.NewReader(content))
+	if ifMatch != "" {
+		r.Header.Set("If-Match", ifMatch)
+	}
+	return serve(PutDocHandler(docs, log), "/api/docs/{id}", login, r)
+}
+
+func TestPutDocVersionConflict(t *testing.T) {
+	docs := memory.NewDocuments()
+	log := &audittest.Recorder{}
+	meta := models.Meta{Token: "notes", Name: "notes.txt", File: true, Access: map[string]models.Permission{"bob": models.PermWrite}}
+	if w := upload(t, docs, log, "alice", meta, "v1"); w.Code != http.StatusOK {
+		t.Fatalf("загрузка: статус %d", w.Code)
+	}
+
+	if w := put(docs, log, "notes", "alice", "", "v2"); w.Code != http.StatusPreconditionRequired {
+		t.Fatalf("без If-Match: статус %d, ожидался 428", w.Code)
+	}
+	if w := put(docs, log, "notes", "alice", `W/"1"`, "v2"); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("слабый ETag: статус %d, ожидался 412", w.Code)
+	}
+	w := put(docs, log, "notes", "bob", `"1"`, "v2")
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"2"` {
+		t.Fatalf("изменение: статус %d, ETag %s", w.Code, w.Header().Get("ETag"))
+	}
+	// Второй редактор прочитал версию 1 и не видел изменений первого
+	if w := put(docs, log, "notes", "alice", `"1"`, "v3"); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("устаревшая версия: статус %d, ожидался 412", w.Code)
+	}
+
+	_, content, err := docs.Get(context.Background(), "notes")
+	if err != nil || string(content) != "v2" {
+		t.Fatalf("содержимое %q, ошибка %v", content, err)
+	}
+
+	// Замена содержимого записывается в журнал как загрузка новой версии
+	entries := log.Entries()
+	if last := entries[len(entries)-1]; len(entries) != 2 || last.Actor != "bob" || last.Action != "doc.upload" || last.Details != `{"version":2}` {
+		t.Fatalf("журнал аудита: %+v", entries)
+	}
+}
+
+func TestTrashAndRestore(t *testing.T) {
+	docs := memory.NewDocuments()
+	log := &audittest.Recorder{}
+	if w := upload(t, docs, log, "alice", models.Meta{Token: "draft", Name: "draft.txt"}, ""); w.Code != http.StatusOK {
+		t.Fatalf("загрузка: статус %d", w.Code)
+	}
+
+	get := func() int {
+		return serve(GetDocHandler(docs, log), "/api/docs/{id}", "alice", httptest.NewRequest(http.MethodGet, "/api/docs/draft", nil)).Code
+	}
+
+	w := serve(DeleteDocHandler(docs, log), "/api/docs/{id}", "alice", httptest.NewRequest(http.MethodDelete, "/api/docs/draft", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("удаление: статус %d", w.Code)
+	}
+	if code := get(); code != http.StatusNotFound {
+		t.Fatalf("документ в корзине: статус %d, ожидался 404", code)
+	}
+
+	// Чужой документ из корзины не восстановить
+	restore := httptest.NewRequest(http.MethodPost, "/api/trash/draft/restore", nil)
+	if w := serve(RestoreTrashHandler(docs, log), "/api/trash/{id}/restore", "bob", restore); w.Code != http.StatusForbidden {
+		t.Fatalf("восстановление чужого документа: статус %d, ожидался 403", w.Code)
+	}
+	restore = httptest.NewRequest(http.MethodPost, "/api/trash/draft/restore", nil)
+	if w := serve(RestoreTrashHandler(docs, log), "/api/trash/{id}/restore", "alice", restore); w.Code != http.StatusOK {
+		t.Fatalf("восстановление: статус %d", w.Code)
+	}
+	if code := get(); code != http.StatusOK {
+		t.Fatalf("восстановленный документ: статус %d", code)
+	}
+
+	if got := strings.Join(log.Actions(), ","); got != "doc.upload,doc.delete,doc.restore,doc.download" {
+		t.Fatalf("журнал аудита: %s", got)
+	}
+}
+
+func TestRestoreVersion(t *testing.T) {
+	docs := memory.NewDocuments()
+	log := &audittest.Recorder{}
+	if w := upload(t, docs, log, "alice", models.Meta{Token: "cfg", Name: "cfg.txt", File: true}, "v1"); w.Code != http.StatusOK {
+		t.Fatalf("загрузка: статус %d", w.Code)
+	}
+	if w := put(docs, log, "cfg", "alice", `"1"`, "v2"); w.Code != http.StatusOK {
+		t.Fatalf("изменение: статус %d", w.Code)
+	}
+
+	restore := func(ifMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/docs/cfg/restore/1", nil)
+		r.Header.Set("If-Match", ifMatch)
+		return serve(RestoreVersionHandler(docs, log), "/api/docs/{id}/restore/{version}", "alice", r)
+	}
+
+	if w := restore(`"1"`); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("устаревшая версия: статус %d, ожидался 412", w.Code)
+	}
+	w := restore(`"2"`)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"3"` {
+		t.Fatalf("восстановление: статус %d, ETag %s", w.Code, w.Header().Get("ETag"))
+	}
+
+	_, content, err := docs.Get(context.Background(), "cfg")
+	if err != nil || string(content) != "v1" {
+		t.Fatalf("содержимое %q, ошибка %v", content, err)
+	}
+	if actions := log.Actions(); actions[len(actions)-1] != "doc.version_restore" {
+		t.Fatalf("журнал аудита: %v", actions)
+	}
+}
@@ -0,0 +1,336 @@
+package rest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cache-web-server/internal/audit"
+	"cache-web-server/internal/loginguard"
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/repository"
+	"cache-web-server/internal/tokens"
+	"cache-web-server/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SharePasswordHeader заголовок с паролем ссылки на документ
+const SharePasswordHeader = "X-Share-Password"
+
+// ShareSigner подписывает ссылки на документы HMAC-SHA256
+type ShareSigner struct {
+	secret  []byte
+	baseURL string
+	maxTTL  time.Duration
+}
+
+// NewShareSigner создает ShareSigner
+func NewShareSigner(secret, baseURL string, maxTTL time.Duration) *ShareSigner {
+	return &ShareSigner{secret: []byte(secret), baseURL: baseURL, maxTTL: maxTTL}
+}
+
+// sign вычисляет подпись ссылки
+func (s *ShareSigner) sign(id string, exp int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(id + "." + strconv.FormatInt(exp, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// url формирует подписанную ссылку
+func (s *ShareSigner) url(id string, exp int64) string {
+	return fmt.Sprintf("%s/s/%s?exp=%d&sig=%s", s.baseURL, id, exp, s.sign(id, exp))
+}
+
+// valid проверяет подпись и срок действия ссылки
+func (s *ShareSigner) valid(id, expParam, sig string) bool {
+	exp, err := strconv.ParseInt(expParam, 10, 64)
+	if err != nil || time.Now().Unix() >= exp {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(s.sign(id, exp)))
+}
+
+// shareRequest тело запроса на создание ссылки
+type shareRequest struct {
+	TTL          int64  `json:"ttl"`
+	Expires      string `json:"expires"`
+	MaxDownloads *int   `json:"max_downloads"`
+	Password     string `json:"password"`
+}
+
+// CreateShareHandler создает подписанную ссылку на документ
+func CreateShareHandler(db *sql.DB, docs repository.DocumentRepository, signer *ShareSigner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		id := chi.URLParam(r, "id")
+		login := r.Context().Value("login").(string)
+
+		if !requireAccess(w, r, docs, id, login, models.PermManage) {
+			return
+		}
+
+		var req shareRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		// Срок действия задается так же, как срок хранения документа, по умолчанию сутки
+		now := time.Now()
+		expires, err := models.Meta{TTL: req.TTL, Expires: req.Expires}.ExpiresAt(now)
+		if err != nil {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+		if expires == nil {
+			e := now.Add(24 * time.Hour)
+			expires = &e
+		}
+		if expires.Sub(now) > signer.maxTTL || (req.MaxDownloads != nil && *req.MaxDownloads <= 0) {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		var passwordHash interface{}
+		if req.Password != "" {
+			hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+			if err != nil {
+				utils.ServerError(w, r, err)
+				return
+			}
+			passwordHash = string(hash)
+		}
+
+		shareID, err := tokens.NewRefreshToken()
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		// Подпись не переживает наносекунды, поэтому храним срок с точностью до секунды
+		exp := expires.Unix()
+		link := models.ShareLink{
+			ID:           shareID,
+			DocID:        id,
+			URL:          signer.url(shareID, exp),
+			Expires:      time.Unix(exp, 0).UTC().Format(time.RFC3339),
+			MaxDownloads: req.MaxDownloads,
+			Password:     passwordHash != nil,
+			CreatedBy:    login,
+		}
+
+		query := `INSERT INTO share_links (id, doc_id, created_by, expires_at, max_downloads, password_hash)
+			VALUES ($1, $2, $3, $4, $5, $6) RETURNING created`
+		err = db.QueryRowContext(r.Context(), query, shareID, id, login, time.Unix(exp, 0), req.MaxDownloads, passwordHash).Scan(&link.Created)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		audit.Record(db, r, login, audit.ActionShareCreate, id, map[string]interface{}{
+			"share":         shareID,
+			"expires":       link.Expires,
+			"max_downloads": req.MaxDownloads,
+			"password":      link.Password,
+		})
+
+		utils.ActResponse(w, "share", link)
+	}
+}
+
+// ListSharesHandler возвращает действующие ссылки на документ
+func ListSharesHandler(db *sql.DB, docs repository.DocumentRepository, signer *ShareSigner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		id := chi.URLParam(r, "id")
+		login := r.Context().Value("login").(string)
+
+		if !requireAccess(w, r, docs, id, login, models.PermManage) {
+			return
+		}
+
+		query := `SELECT id, doc_id, expires_at, max_downloads, downloads, password_hash IS NOT NULL, created_by, created
+			FROM share_links WHERE doc_id = $1 AND revoked_at IS NULL AND expires_at > NOW() ORDER BY created`
+		rows, err := db.QueryContext(r.Context(), query, id)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+		defer rows.Close()
+
+		links := []models.ShareLink{}
+		for rows.Next() {
+			var link models.ShareLink
+			var expires time.Time
+			var maxDownloads sql.NullInt32
+			if err := rows.Scan(&link.ID, &link.DocID, &expires, &maxDownloads, &link.Downloads, &link.Password, &link.CreatedBy, &link.Created); err != nil {
+				utils.ServerError(w, r, err)
+				return
+			}
+			if maxDownloads.Valid {
+				n := int(maxDownloads.Int32)
+				link.MaxDownloads = &n
+			}
+			link.Expires = expires.UTC().Format(time.RFC3339)
+			link.URL = signer.url(link.ID, expires.Unix())
+			links = append(links, link)
+		}
+		if err := rows.Err(); err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		utils.ActResponse(w, "shares", links)
+	}
+}
+
+// RevokeShareHandler отзывает ссылку на документ
+func RevokeShareHandler(db *sql.DB, docs repository.DocumentRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		shareID := chi.URLParam(r, "share")
+		login := r.Context().Value("login").(string)
+
+		var docID string
+		err := db.QueryRowContext(r.Context(), `SELECT doc_id FROM share_links WHERE id = $1 AND revoked_at IS NULL`, shareID).Scan(&docID)
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.ErrorResponse(w, 404)
+			return
+		}
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		if !requireAccess(w, r, docs, docID, login, models.PermManage) {
+			return
+		}
+
+		if _, err := db.ExecContext(r.Context(), `UPDATE share_links SET revoked_at = NOW() WHERE id = $1`, shareID); err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		audit.Record(db, r, login, audit.ActionShareRevoke, docID, map[string]interface{}{"share": shareID})
+
+		utils.ActResponse(w, shareID, true)
+	}
+}
+
+// SharedDocHandler отдает документ по подписанной ссылке без авторизации.
+// Пароль передается в заголовке X-Share-Password или полем формы password в POST.
+// Неверные пароли учитываются guard по ссылке и IP, как попытки входа.
+func SharedDocHandler(db *sql.DB, docs repository.DocumentRepository, signer *ShareSigner, guard *loginguard.Guard) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		shareID := chi.URLParam(r, "share")
+		if !signer.valid(shareID, r.URL.Query().Get("exp"), r.URL.Query().Get("sig")) {
+			utils.ErrorResponse(w, 403)
+			return
+		}
+
+		// Проверяем пароль ссылки
+		var docID string
+		var passwordHash sql.NullString
+		query := `SELECT doc_id, password_hash FROM share_links WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW()`
+		err := db.QueryRowContext(r.Context(), query, shareID).Scan(&docID, &passwordHash)
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.ErrorResponse(w, 404)
+			return
+		}
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+		if passwordHash.Valid {
+			// Перебор пароля блокируется раньше, чем дело дойдет до bcrypt
+			subject, ip := loginguard.Share(shareID), utils.ClientIP(r)
+			retryAfter, err := guard.Check(r.Context(), subject, ip)
+			if err != nil {
+				utils.ServerError(w, r, err)
+				return
+			}
+			if retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+				utils.ErrorResponse(w, 429)
+				return
+			}
+
+			password := r.Header.Get(SharePasswordHeader)
+			if password == "" && r.Method == http.MethodPost {
+				password = r.FormValue("password")
+			}
+			if bcrypt.CompareHashAndPassword([]byte(passwordHash.String), []byte(password)) != nil {
+				if err := guard.Fail(r.Context(), subject, ip); err != nil {
+					slog.ErrorContext(r.Context(), "не удалось учесть неверный пароль ссылки", "error", err)
+				}
+				utils.ErrorResponse(w, 401)
+				return
+			}
+			if err := guard.Succeed(r.Context(), subject); err != nil {
+				slog.ErrorContext(r.Context(), "не удалось сбросить счетчик пароля ссылки", "error", err)
+			}
+		}
+
+		// Документ должен быть активным, скачивание по ссылке учитывается только после этой проверки
+		doc, file, err := docs.Get(r.Context(), docID)
+		if errors.Is(err, repository.ErrNotFound) {
+			utils.ErrorResponse(w, 404)
+			return
+		}
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		// Учитываем скачивание, если лимит еще не исчерпан
+		query = `UPDATE share_links SET downloads = downloads + 1
+			WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+				AND (max_downloads IS NULL OR downloads < max_downloads)`
+		res, err := db.ExecContext(r.Context(), query, shareID)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			utils.ErrorResponse(w, 410)
+			return
+		}
+
+		audit.Record(db, r, "", audit.ActionShareDownload, docID, map[string]interface{}{"share": shareID})
+
+		w.Header().Set("Cache-Control", "no-store")
+		if doc.File {
+			w.Header().Set("Content-Type", doc.Mime)
+			writeContent(w, r, file)
+		} else {
+			utils.DataResponse(w, []models.Document{doc})
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+
+	"cache-web-server/internal/audit"
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/repository"
+	"cache-web-server/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ListTrashHandler возвращает документы в корзине текущего пользователя
+func ListTrashHandler(docs repository.DocumentRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		login := r.Context().Value("login").(string)
+
+		list, err := docs.ListTrash(r.Context(), login)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		utils.DataResponse(w, list)
+	}
+}
+
+// RestoreTrashHandler возвращает документ из корзины
+func RestoreTrashHandler(docs repository.DocumentRepository, auditLog audit.Execer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		id := chi.URLParam(r, "id")
+		login := r.Context().Value("login").(string)
+
+		if !requireTrashAccess(w, r, docs, id, login, models.PermManage) {
+			return
+		}
+
+		err := docs.Untrash(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			utils.ErrorResponse(w, 404)
+			return
+		}
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		audit.Record(auditLog, r, login, audit.ActionRestore, id, nil)
+
+		utils.ActResponse(w, id, true)
+	}
+}
+
+// PurgeTrashHandler окончательно удаляет документ из корзины
+func PurgeTrashHandler(docs repository.DocumentRepository, auditLog audit.Execer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		id := chi.URLParam(r, "id")
+		login := r.Context().Value("login").(string)
+
+		if !requireTrashAccess(w, r, docs, id, login, models.PermManage) {
+			return
+		}
+
+		err := docs.Purge(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			utils.ErrorResponse(w, 404)
+			return
+		}
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		audit.Record(auditLog, r, login, audit.ActionPurge, id, nil)
+
+		utils.ActResponse(w, id, true)
+	}
+}
@@ -0,0 +1,288 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"cache-web-server/internal/audit"
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/repository"
+	"cache-web-server/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxContentSize максимальный размер содержимого документа
+const maxContentSize = 10 << 20
+
+// etag формирует значение ETag по версии документа
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// ifMatchVersion разбирает заголовок If-Match.
+// Возвращает repository.AnyVersion для "*", ok = false если заголовок отсутствует или некорректен.
+func ifMatchVersion(r *http.Request) (version int, present bool, ok bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return 0, false, false
+	}
+	if header == "*" {
+		return repository.AnyVersion, true, true
+	}
+
+	version, err := strconv.Atoi(strings.Trim(header, `"`))
+	if err != nil || version <= 0 {
+		return 0, true, false
+	}
+	return version, true, true
+}
+
+// checkIfMatch проверяет If-Match и при ошибке сам пишет ответ.
+// If-Match требует строгого сравнения (RFC 9110, 13.1.1), слабый ETag ни с чем не совпадает.
+func checkIfMatch(w http.ResponseWriter, r *http.Request) (int, bool) {
+	version, present, ok := ifMatchVersion(r)
+	if !present {
+		utils.ErrorResponse(w, 428)
+		return 0, false
+	}
+	if strings.HasPrefix(strings.TrimSpace(r.Header.Get("If-Match")), "W/") {
+		utils.ErrorResponse(w, 412)
+		return 0, false
+	}
+	if !ok {
+		utils.ErrorResponse(w, 400)
+		return 0, false
+	}
+	return version, true
+}
+
+// errInvalidPatch патч неприменим к метаданным документа
+var errInvalidPatch = errors.New("некорректный патч")
+
+// writeVersion пишет ETag новой версии документа или ответ с ошибкой изменения.
+// Несовпадение версии — 412, некорректный патч или несуществующая группа — 400.
+func writeVersion(w http.ResponseWriter, r *http.Request, version int, err error) bool {
+	if errors.Is(err, repository.ErrNotFound) {
+		utils.ErrorResponse(w, 404)
+		return false
+	}
+	if errors.Is(err, repository.ErrVersionConflict) {
+		utils.ErrorResponse(w, 412)
+		return false
+	}
+	if errors.Is(err, repository.ErrUnknownGroup) || errors.Is(err, errInvalidPatch) {
+		utils.ErrorResponse(w, 400)
+		return false
+	}
+	if err != nil {
+		utils.ServerError(w, r, err)
+		return false
+	}
+
+	w.Header().Set("ETag", etag(version))
+	return true
+}
+
+// PutDocHandler заменяет содержимое документа телом запроса
+func PutDocHandler(docs repository.DocumentRepository, auditLog audit.Execer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		id := chi.URLParam(r, "id")
+		login := r.Context().Value("login").(string)
+
+		// Проверяем права на запись
+		if !requireAccess(w, r, docs, id, login, models.PermWrite) {
+			return
+		}
+
+		version, ok := checkIfMatch(w, r)
+		if !ok {
+			return
+		}
+
+		// Читаем новое содержимое с ограничением размера
+		content, err := readContent(r.Context(), http.MaxBytesReader(w, r.Body, maxContentSize))
+		if err != nil {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		// Тип содержимого берем из заголовка, если он передан
+		mime := r.Header.Get("Content-Type")
+		next, err := docs.UpdateContent(r.Context(), id, version, content, mime, login)
+		if !writeVersion(w, r, next, err) {
+			return
+		}
+
+		audit.Record(auditLog, r, login, audit.ActionUpload, id, map[string]interface{}{"version": next})
+
+		utils.ActResponse(w, id, true)
+	}
+}
+
+// PatchDocHandler изменяет метаданные документа по правилам JSON Merge Patch (RFC 7386)
+func PatchDocHandler(docs repository.DocumentRepository, auditLog audit.Execer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		id := chi.URLParam(r, "id")
+		login := r.Context().Value("login").(string)
+
+		// Разбираем патч
+		var patch map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		// Изменение доступа требует права manage, остальных полей — write
+		required := models.PermWrite
+		_, hasPublic := patch["public"]
+		_, hasGrant := patch["grant"]
+		_, hasAccess := patch["access"]
+		if hasPublic || hasGrant || hasAccess {
+			required = models.PermManage
+		}
+		if !requireAccess(w, r, docs, id, login, required) {
+			return
+		}
+
+		version, ok := checkIfMatch(w, r)
+		if !ok {
+			return
+		}
+
+		// Патч применяется к текущему состоянию документа внутри репозитория
+		var doc models.Document
+		next, err := docs.UpdateMeta(r.Context(), id, version, login, func(current *models.Document) error {
+			if err := applyMergePatch(current, patch); err != nil {
+				return fmt.Errorf("%w: %v", errInvalidPatch, err)
+			}
+			if current.Name == "" || !validGrants(current.Access) {
+				return errInvalidPatch
+			}
+			doc = *current
+			return nil
+		})
+		if !writeVersion(w, r, next, err) {
+			return
+		}
+
+		if hasPublic || hasGrant || hasAccess {
+			audit.Record(auditLog, r, login, audit.ActionPermissions, id, map[string]interface{}{
+				"public": doc.Public,
+				"access": doc.Access,
+			})
+		}
+
+		utils.ActResponse(w, id, true)
+	}
+}
+
+// applyMergePatch применяет патч к метаданным документа.
+// null сбрасывает поле, grant заменяет список логинов с правом чтения,
+// access сливается по логинам (null удаляет право).
+func applyMergePatch(doc *models.Document, patch map[string]json.RawMessage) error {
+	for key := range patch {
+		if !containsString(patchFields, key) {
+			return fmt.Errorf("неизвестное поле %s", key)
+		}
+	}
+
+	// Поля применяются в фиксированном порядке, чтобы access перекрывал grant
+	for _, key := range patchFields {
+		raw, ok := patch[key]
+		if !ok {
+			continue
+		}
+		isNull := bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+
+		switch key {
+		case "name":
+			if isNull {
+				return fmt.Errorf("поле name обязательно")
+			}
+			if err := json.Unmarshal(raw, &doc.Name); err != nil {
+				return err
+			}
+		case "mime":
+			doc.Mime = ""
+			if !isNull {
+				if err := json.Unmarshal(raw, &doc.Mime); err != nil {
+					return err
+				}
+			}
+		case "public":
+			doc.Public = false
+			if !isNull {
+				if err := json.Unmarshal(raw, &doc.Public); err != nil {
+					return err
+				}
+			}
+		case "grant":
+			var logins []string
+			if !isNull {
+				if err := json.Unmarshal(raw, &logins); err != nil {
+					return err
+				}
+			}
+			for login, perm := range doc.Access {
+				if perm == models.PermRead {
+					delete(doc.Access, login)
+				}
+			}
+			for _, l := range logins {
+				if l == "" {
+					continue
+				}
+				if _, exists := doc.Access[l]; !exists {
+					doc.Access[l] = models.PermRead
+				}
+			}
+		case "access":
+			if isNull {
+				doc.Access = map[string]models.Permission{}
+				continue
+			}
+			var changes map[string]*models.Permission
+			if err := json.Unmarshal(raw, &changes); err != nil {
+				return err
+			}
+			for l, perm := range changes {
+				if perm == nil {
+					delete(doc.Access, l)
+				} else if l != "" {
+					doc.Access[l] = *perm
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// patchFields поля документа, доступные для изменения через PATCH
+var patchFields = []string{"name", "mime", "public", "grant", "access"}
+
+// containsString проверяет наличие строки в срезе
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
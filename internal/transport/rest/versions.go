@@ -0,0 +1,207 @@
+package rest
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"cache-web-server/internal/audit"
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/repository"
+	"cache-web-server/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// versionParam читает номер версии из параметров пути
+func versionParam(r *http.Request, name string) (int, bool) {
+	version, err := strconv.Atoi(chi.URLParam(r, name))
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// ListVersionsHandler возвращает историю версий документа
+func ListVersionsHandler(docs repository.DocumentRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		id := chi.URLParam(r, "id")
+		login := r.Context().Value("login").(string)
+
+		if !requireAccess(w, r, docs, id, login, models.PermRead) {
+			return
+		}
+
+		versions, err := docs.Versions(r.Context(), id)
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		utils.VersionsResponse(w, versions)
+	}
+}
+
+// GetVersionHandler возвращает содержимое конкретной версии документа
+func GetVersionHandler(docs repository.DocumentRepository, auditLog audit.Execer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		id := chi.URLParam(r, "id")
+		login := r.Context().Value("login").(string)
+		version, ok := versionParam(r, "version")
+		if !ok {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		if !requireAccess(w, r, docs, id, login, models.PermRead) {
+			return
+		}
+
+		v, file, err := docs.GetVersion(r.Context(), id, version)
+		if errors.Is(err, repository.ErrNotFound) {
+			utils.ErrorResponse(w, 404)
+			return
+		}
+		if err != nil {
+			utils.ServerError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", v.Mime)
+		w.Header().Set("ETag", etag(v.Version))
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		audit.Record(auditLog, r, login, audit.ActionDownload, id, map[string]interface{}{"version": v.Version})
+
+		if v.File {
+			writeContent(w, r, file)
+		} else {
+			utils.VersionsResponse(w, []models.Version{v})
+		}
+	}
+}
+
+// DiffVersionsHandler сравнивает метаданные двух версий документа
+func DiffVersionsHandler(docs repository.DocumentRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		id := chi.URLParam(r, "id")
+		login := r.Context().Value("login").(string)
+
+		from, err := strconv.Atoi(r.URL.Query().Get("from"))
+		if err != nil {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+		to, err := strconv.Atoi(r.URL.Query().Get("to"))
+		if err != nil {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		if !requireAccess(w, r, docs, id, login, models.PermRead) {
+			return
+		}
+
+		// Читаем обе версии, содержимое сравниваем по хэшу
+		a, fileA, errA := docs.GetVersion(r.Context(), id, from)
+		b, fileB, errB := docs.GetVersion(r.Context(), id, to)
+		if errors.Is(errA, repository.ErrNotFound) || errors.Is(errB, repository.ErrNotFound) {
+			utils.ErrorResponse(w, 404)
+			return
+		}
+		if errA != nil || errB != nil {
+			utils.ServerError(w, r, errors.Join(errA, errB))
+			return
+		}
+
+		changes := map[string]interface{}{}
+		addChange := func(field string, before, after interface{}) {
+			if !reflect.DeepEqual(before, after) {
+				changes[field] = map[string]interface{}{"from": before, "to": after}
+			}
+		}
+		addChange("name", a.Name, b.Name)
+		addChange("mime", a.Mime, b.Mime)
+		addChange("file", a.File, b.File)
+		addChange("public", a.Public, b.Public)
+		addChange("access", a.Access, b.Access)
+		if hashA, hashB := contentHash(fileA), contentHash(fileB); hashA != hashB {
+			changes["content"] = map[string]interface{}{"from": hashA, "to": hashB}
+		}
+
+		utils.WriteJSONResponse(w, 200, models.APIResponse{
+			Response: map[string]interface{}{
+				"from":    from,
+				"to":      to,
+				"changes": changes,
+			},
+		})
+	}
+}
+
+// RestoreVersionHandler восстанавливает содержимое и метаданные документа из версии.
+// Восстановление создает новую версию, права доступа не меняются.
+func RestoreVersionHandler(docs repository.DocumentRepository, auditLog audit.Execer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.ErrorResponse(w, 405)
+			return
+		}
+
+		id := chi.URLParam(r, "id")
+		login := r.Context().Value("login").(string)
+		version, ok := versionParam(r, "version")
+		if !ok {
+			utils.ErrorResponse(w, 400)
+			return
+		}
+
+		if !requireAccess(w, r, docs, id, login, models.PermWrite) {
+			return
+		}
+
+		current, ok := checkIfMatch(w, r)
+		if !ok {
+			return
+		}
+
+		next, err := docs.RestoreVersion(r.Context(), id, version, current, login)
+		if !writeVersion(w, r, next, err) {
+			return
+		}
+
+		audit.Record(auditLog, r, login, audit.ActionVersionRestore, id, map[string]interface{}{"from": version, "version": next})
+
+		utils.ActResponse(w, id, true)
+	}
+}
+
+// contentHash возвращает md5 содержимого версии в hex, пустую строку для версии без файла
+func contentHash(content []byte) string {
+	if content == nil {
+		return ""
+	}
+	sum := md5.Sum(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -1,12 +1,31 @@
 package transport
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
 	"cache-web-server/config"
+	"cache-web-server/internal/apikeys"
+	"cache-web-server/internal/certs"
+	dbpkg "cache-web-server/internal/db"
+	"cache-web-server/internal/health"
+	"cache-web-server/internal/jobs"
+	"cache-web-server/internal/logging"
+	"cache-web-server/internal/loginguard"
+	"cache-web-server/internal/metrics"
+	"cache-web-server/internal/models"
+	"cache-web-server/internal/oidc"
+	"cache-web-server/internal/repository/postgres"
+	"cache-web-server/internal/sessions"
+	"cache-web-server/internal/tokens"
+	"cache-web-server/internal/tracing"
+	"cache-web-server/internal/transport/admin"
 	"cache-web-server/internal/transport/auth"
 	"cache-web-server/internal/transport/auth/middleware"
 	"cache-web-server/internal/transport/rest"
@@ -23,46 +42,248 @@ func GetPort() string {
 	return port
 }
 
-// StartServer запускает веб-сервер на указанном порту
-func StartServer(port string, db *sql.DB) {
+// StartServer запускает веб-сервер на указанном порту и работает до отмены ctx.
+// При отмене сервер перестает быть готовым, через SHUTDOWN_DELAY прекращает
+// принимать соединения и ждет завершения текущих запросов не дольше SHUTDOWN_TIMEOUT,
+// после чего останавливает свои фоновые воркеры.
+func StartServer(ctx context.Context, port string, db *sql.DB) error {
 	r := chi.NewRouter()
+	r.Use(logging.RequestIDMiddleware, tracing.Middleware, logging.AccessLogMiddleware, metrics.Middleware)
 
-	// Получаем adminToken
-	adminToken := config.AdminToken()
-	if adminToken == "" {
-		log.Fatal("ADMIN_TOKEN не установлен в .env")
-	}
+	// Фоновые воркеры сервера останавливаются после завершения запросов
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var workers []<-chan struct{}
 
-	// Получаем JWT_SECRET из переменной окружения
-	JWTSecret := os.Getenv("JWT_SECRET")
-	if JWTSecret == "" {
-		log.Fatal("JWT_SECRET не установлен в .env")
+	// Ключи подписи: каталог асимметричных ключей или общий секрет JWT_SECRET
+	var keys tokens.KeySource
+	var keyRing *tokens.KeyRing
+	if dir := config.JWTKeysDir(); dir != "" {
+		// Токены прежнего ключа должны приниматься, пока не истекут последние из них
+		if overlap, ttl := config.JWTKeyOverlap(), config.AccessTokenTTL(); overlap < ttl {
+			return fmt.Errorf("JWT_KEY_OVERLAP (%s) не может быть меньше ACCESS_TOKEN_TTL (%s)", overlap, ttl)
+		}
+		var err error
+		keyRing, err = tokens.NewKeyRing(dir, config.JWTKeyAlg(), config.JWTKeyOverlap())
+		if err != nil {
+			return fmt.Errorf("ошибка загрузки ключей подписи: %w", err)
+		}
+		workers = append(workers, keyRing.Start(workersCtx, config.JWTKeysReload(), config.JWTKeyRotation()))
+		keys = keyRing
+	} else {
+		JWTSecret := os.Getenv("JWT_SECRET")
+		if JWTSecret == "" {
+			return errors.New("JWT_SECRET не установлен в .env")
+		}
+		keys = tokens.NewSecretSource(JWTSecret)
 	}
 
+	// Хранилище сессий для проверки отзыва токенов
+	store := sessions.NewStore(db, config.SessionCacheTTL())
+	warmDone := make(chan struct{})
+	go func() {
+		defer close(warmDone)
+		if err := store.Warm(workersCtx, config.AccessTokenTTL()); err != nil {
+			slog.Error("ошибка при заполнении кэша сессий", "error", err)
+		}
+	}()
+	workers = append(workers, warmDone)
+
+	// Проверки живости и готовности для оркестратора, без авторизации
+	checker := health.New(config.HealthCheckTimeout())
+	checker.Add("database", db.PingContext)
+	checker.Add("storage", func(ctx context.Context) error { return dbpkg.CheckStorage(ctx, db) })
+	checker.Add("cache", store.CheckWarm)
+	checker.Add("schema", func(ctx context.Context) error { return dbpkg.CheckSchema(ctx, db) })
+	r.Get("/healthz", checker.LiveHandler())
+	r.Get("/readyz", checker.ReadyHandler())
+
+	// Метрики в формате Prometheus, при заданном METRICS_TOKEN доступны только с ним
+	registerMetrics(db, store, config.RefreshTokenTTL())
+	r.Get("/metrics", metricsHandler(config.MetricsToken()))
+
+	// Выпуск и проверка access-токенов
+	issuer := tokens.NewIssuer(keys, config.JWTIssuer(), config.AccessTokenTTL())
+	refreshTTL := config.RefreshTokenTTL()
+
+	// Хранилища документов и пользователей, через которые работают обработчики
+	docs := postgres.NewDocuments(db)
+	users := postgres.NewUsers(db)
+
 	// Подключаем middleware для авторизации
-	authMiddleware := middleware.AuthMiddleware(db, JWTSecret)
+	apiKeys := apikeys.NewStore(db)
+	authMiddleware := middleware.AuthMiddleware(users, issuer, store, apiKeys)
+
+	// Защита входа от перебора паролей
+	guard := loginguard.New(db, loginguard.Policy{
+		MaxLoginFailures: config.LoginMaxAttempts(),
+		MaxIPFailures:    config.LoginMaxAttemptsIP(),
+		Window:           config.LoginAttemptWindow(),
+		BaseLockout:      config.LoginLockoutBase(),
+		MaxLockout:       config.LoginLockoutMax(),
+	})
+	workers = append(workers, jobs.StartAttemptsCleanup(workersCtx, guard, config.LoginAttemptWindow()))
 
-	// Обработчики для регистрации и аутентификации пользователя
-	r.Post("/api/register", auth.RegisterHandler(db, adminToken))
-	r.Post("/api/auth", auth.AuthHandler(db, JWTSecret))
+	// Обработчики для аутентификации пользователя
+	r.Post("/api/auth", auth.AuthHandler(users, db, issuer, store, guard, refreshTTL))
+	r.Post("/api/auth/refresh", auth.RefreshHandler(issuer, store, refreshTTL))
+	r.Post("/api/auth/reset", auth.ResetPasswordHandler(users, store, db))
+	r.Get("/.well-known/jwks.json", auth.JWKSHandler(keyRing))
 
-	// Обработчики для работы с документами, требующие авторизации
+	// Ссылки на документы для пользователей без учетной записи
+	shareSecret := config.ShareLinkSecret()
+	if shareSecret == "" {
+		return errors.New("SHARE_LINK_SECRET не установлен в .env")
+	}
+	if shareSecret == os.Getenv("JWT_SECRET") {
+		return errors.New("SHARE_LINK_SECRET должен отличаться от JWT_SECRET")
+	}
+	shareSigner := rest.NewShareSigner(shareSecret, config.PublicBaseURL(), config.ShareLinkMaxTTL())
+	r.Get("/s/{share}", rest.SharedDocHandler(db, docs, shareSigner, guard))
+	r.Post("/s/{share}", rest.SharedDocHandler(db, docs, shareSigner, guard))
+
+	// Вход через OpenID Connect
+	if oidcIssuer, clientID, clientSecret, redirectURL, scopes := config.OIDC(); oidcIssuer != "" {
+		provider := oidc.NewProvider(oidc.Config{
+			Issuer:       oidcIssuer,
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       scopes,
+		}, &http.Client{Timeout: 10 * time.Second, Transport: &tracing.Transport{}})
+		r.Get("/api/auth/oidc/login", auth.OIDCLoginHandler(db, provider))
+		r.Get("/api/auth/oidc/callback", auth.OIDCCallbackHandler(db, users, provider, issuer, store, refreshTTL, config.OIDCAutoProvision()))
+	}
+
+	// Обработчики, требующие авторизации
 	r.Group(func(r chi.Router) {
 		r.Use(authMiddleware)
 
-		r.Post("/api/docs", rest.UploadHandler(db))
-		r.Get("/api/docs", rest.ListDocsHandler(db))
-		r.Head("/api/docs", rest.ListDocsHandler(db))
-		r.Get("/api/docs/{id}", rest.GetDocHandler(db))
-		r.Head("/api/docs/{id}", rest.GetDocHandler(db))
-		r.Delete("/api/docs/{id}", rest.DeleteDocHandler(db))
-		r.Delete("/api/auth/{token}", rest.LogoutHandler(db))
+		// Обработчики для работы с документами, пользователям readonly доступно только чтение
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.DenyReadOnly)
+
+			r.Post("/api/docs", rest.UploadHandler(docs, db))
+			r.Get("/api/docs", rest.ListDocsHandler(docs))
+			r.Head("/api/docs", rest.ListDocsHandler(docs))
+			r.Get("/api/docs/{id}", rest.GetDocHandler(docs, db))
+			r.Head("/api/docs/{id}", rest.GetDocHandler(docs, db))
+			r.Put("/api/docs/{id}", rest.PutDocHandler(docs, db))
+			r.Patch("/api/docs/{id}", rest.PatchDocHandler(docs, db))
+			r.Delete("/api/docs/{id}", rest.DeleteDocHandler(docs, db))
+			r.Get("/api/docs/{id}/versions", rest.ListVersionsHandler(docs))
+			r.Get("/api/docs/{id}/versions/{version}", rest.GetVersionHandler(docs, db))
+			r.Head("/api/docs/{id}/versions/{version}", rest.GetVersionHandler(docs, db))
+			r.Get("/api/docs/{id}/diff", rest.DiffVersionsHandler(docs))
+			r.Post("/api/docs/{id}/restore/{version}", rest.RestoreVersionHandler(docs, db))
+			r.Get("/api/trash", rest.ListTrashHandler(docs))
+			r.Head("/api/trash", rest.ListTrashHandler(docs))
+			r.Post("/api/trash/{id}/restore", rest.RestoreTrashHandler(docs, db))
+			r.Delete("/api/trash/{id}", rest.PurgeTrashHandler(docs, db))
+			r.Post("/api/docs/{id}/share", rest.CreateShareHandler(db, docs, shareSigner))
+			r.Get("/api/docs/{id}/shares", rest.ListSharesHandler(db, docs, shareSigner))
+			r.Delete("/api/shares/{share}", rest.RevokeShareHandler(db, docs))
+		})
+
+		// Группы пользователей для выдачи прав на документы
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.DenyReadOnly)
 
+			r.Post("/api/groups", rest.CreateGroupHandler(db, users))
+			r.Get("/api/groups", rest.ListGroupsHandler(db))
+			r.Get("/api/groups/{name}", rest.GetGroupHandler(db))
+			r.Post("/api/groups/{name}/members", rest.AddMembersHandler(db, users))
+			r.Delete("/api/groups/{name}/members/{login}", rest.RemoveMemberHandler(db))
+			r.Delete("/api/groups/{name}", rest.DeleteGroupHandler(db))
+		})
+
+		// Обработчики для управления сессиями и ключами
+		r.Delete("/api/auth/{token}", rest.LogoutHandler(db, store))
+		r.Post("/api/auth/password", auth.ChangePasswordHandler(users, store, guard, db))
+		r.Post("/api/keys", auth.CreateAPIKeyHandler(apiKeys, db))
+		r.Get("/api/keys", auth.ListAPIKeysHandler(apiKeys))
+		r.Delete("/api/keys/{id}", auth.RevokeAPIKeyHandler(apiKeys, db))
+
+		// Обработчики, доступные только администраторам
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireRole(models.RoleAdmin))
+
+			r.Post("/api/register", auth.RegisterHandler(users, db))
+			r.Get("/api/admin/users", admin.ListUsersHandler(users))
+			r.Post("/api/admin/users/{login}/disable", admin.SetDisabledHandler(users, store, db, true))
+			r.Post("/api/admin/users/{login}/enable", admin.SetDisabledHandler(users, store, db, false))
+			r.Put("/api/admin/users/{login}/email", admin.SetEmailHandler(users, db))
+			r.Post("/api/admin/users/{login}/force-reset", admin.ForceResetHandler(users, store, db))
+			r.Post("/api/admin/users/{login}/reset-token", auth.IssueResetTokenHandler(users, store, db, config.ResetTokenTTL()))
+			r.Post("/api/admin/users/{login}/unlock", admin.UnlockHandler(guard, db))
+			r.Delete("/api/admin/users/{login}", admin.DeleteUserHandler(users, db))
+			r.Get("/api/admin/users/{login}/sessions", admin.UserSessionsHandler(store))
+			r.Get("/api/admin/users/{login}/certificates", admin.ListCertificatesHandler(users))
+			r.Post("/api/admin/users/{login}/certificates", admin.AddCertificateHandler(users, db))
+			r.Delete("/api/admin/users/{login}/certificates", admin.RemoveCertificateHandler(users, db))
+			r.Get("/api/admin/audit", admin.AuditHandler(db))
+			r.Get("/api/admin/audit/export", admin.ExportAuditHandler(db))
+		})
 	})
 
-	log.Printf("Сервер запущен на порту: %s\n", port)
-	err := http.ListenAndServe(":"+port, r)
-	if err != nil {
-		log.Fatal("Ошибка при запуске сервера: ", err)
+	server := &http.Server{Addr: ":" + port, Handler: r}
+
+	// Без сертификата сервер работает по HTTP
+	tlsConfig := config.TLS()
+	if tlsConfig.CertFile != "" {
+		// Сертификат перечитывается при изменении файлов без перезапуска,
+		// корневые сертификаты клиентов — только при перезапуске
+		reloader, err := certs.NewReloader(tlsConfig.CertFile, tlsConfig.KeyFile)
+		if err != nil {
+			return fmt.Errorf("ошибка загрузки сертификата: %w", err)
+		}
+		workers = append(workers, reloader.Start(workersCtx, tlsConfig.ReloadInterval))
+
+		server.TLSConfig, err = certs.ServerConfig(reloader, certs.Options{
+			ClientCAFile: tlsConfig.ClientCAFile,
+			ClientAuth:   tlsConfig.ClientAuth,
+			MinVersion:   tlsConfig.MinVersion,
+			CipherSuites: tlsConfig.CipherSuites,
+		})
+		if err != nil {
+			return fmt.Errorf("ошибка настройки TLS: %w", err)
+		}
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("сервер запущен", "port", port, "tls", server.TLSConfig != nil)
+		if server.TLSConfig != nil {
+			serveErr <- server.ListenAndServeTLS("", "")
+		} else {
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+	checker.SetReady(true)
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("ошибка при запуске сервера: %w", err)
+	case <-ctx.Done():
+	}
+
+	// Сначала снимаем готовность, чтобы балансировщик перестал присылать запросы
+	checker.SetReady(false)
+	slog.Info("остановка сервера")
+	time.Sleep(config.ShutdownDelay())
+
+	// Ждем завершения текущих запросов, по истечении таймаута закрываем соединения
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout())
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("не все запросы завершились до таймаута", "error", err)
+		server.Close()
 	}
+
+	stopWorkers()
+	for _, done := range workers {
+		<-done
+	}
+
+	return nil
 }
@@ -2,35 +2,55 @@ package utils
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"cache-web-server/internal/models"
 )
 
 // HTTP-статусы по заданию
 var httpStatus = map[int]string{
-	http.StatusOK:                  "Все ок",
-	http.StatusBadRequest:          "Некорректные параметры",
-	http.StatusUnauthorized:        "Не авторизован",
-	http.StatusForbidden:           "Нет прав доступа",
-	http.StatusMethodNotAllowed:    "Неверный метод запроса",
-	http.StatusInternalServerError: "Нежданчик",
-	http.StatusNotImplemented:      "Метод не реализован",
+	http.StatusOK:                   "Все ок",
+	http.StatusBadRequest:           "Некорректные параметры",
+	http.StatusUnauthorized:         "Не авторизован",
+	http.StatusForbidden:            "Нет прав доступа",
+	http.StatusNotFound:             "Не найдено",
+	http.StatusMethodNotAllowed:     "Неверный метод запроса",
+	http.StatusConflict:             "Конфликт",
+	http.StatusGone:                 "Ресурс больше недоступен",
+	http.StatusPreconditionFailed:   "Документ был изменен",
+	http.StatusPreconditionRequired: "Требуется заголовок If-Match",
+	http.StatusTooManyRequests:      "Слишком много запросов",
+	http.StatusInternalServerError:  "Нежданчик",
+	http.StatusNotImplemented:       "Метод не реализован",
 }
 
 // ErrorResponse формирует ответ с ошибкой
 func ErrorResponse(w http.ResponseWriter, code int) {
+	ErrorMessage(w, code, httpStatus[code])
+}
+
+// ErrorMessage формирует ответ с ошибкой и пояснением вместо стандартного текста статуса
+func ErrorMessage(w http.ResponseWriter, code int, text string) {
 	errResp := models.APIResponse{
 		Error: &models.Error{
 			Code: code,
-			Text: httpStatus[code],
+			Text: text,
 		},
 	}
 
 	WriteJSONResponse(w, code, errResp)
 }
 
+// ServerError логирует ошибку обработки запроса и отвечает 500.
+// Идентификатор запроса и логин добавляются в запись из контекста.
+func ServerError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.ErrorContext(r.Context(), "ошибка обработки запроса",
+		"error", err, "method", r.Method, "path", r.URL.Path)
+	ErrorResponse(w, http.StatusInternalServerError)
+}
+
 // ActResponse формирует ответ подтверждения действия
 func ActResponse(w http.ResponseWriter, key string, value interface{}) {
 	actResp := models.APIResponse{
@@ -42,6 +62,19 @@ func ActResponse(w http.ResponseWriter, key string, value interface{}) {
 	WriteJSONResponse(w, 200, actResp)
 }
 
+// TokenResponse формирует ответ с access- и refresh-токеном
+func TokenResponse(w http.ResponseWriter, token, refresh string, expiresIn time.Duration) {
+	tokenResp := models.APIResponse{
+		Response: map[string]interface{}{
+			"token":         token,
+			"refresh_token": refresh,
+			"expires_in":    int(expiresIn.Seconds()),
+		},
+	}
+
+	WriteJSONResponse(w, 200, tokenResp)
+}
+
 // UploadResponse формирует ответ с данными загруженного файла
 func UploadResponse(w http.ResponseWriter, jsonParsed map[string]interface{}, name string) {
 	uploadResp := models.APIResponse{
@@ -65,11 +98,22 @@ func DataResponse(w http.ResponseWriter, docs []models.Document) {
 	WriteJSONResponse(w, 200, dataResp)
 }
 
+// VersionsResponse формирует ответ со списком версий документа
+func VersionsResponse(w http.ResponseWriter, versions []models.Version) {
+	versionsResp := models.APIResponse{
+		Data: &models.Data{
+			Versions: versions,
+		},
+	}
+
+	WriteJSONResponse(w, 200, versionsResp)
+}
+
 // WriteJSONResponse отправляет JSON-ответ клиенту
 func WriteJSONResponse(w http.ResponseWriter, statusCode int, resp interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		log.Printf("Не удалось закодировать ответ: %v", err)
+		slog.Error("не удалось закодировать ответ", "error", err)
 	}
 }
@@ -0,0 +1,51 @@
+package utils
+
+import "net/http"
+
+// StatusWriter запоминает статус ответа и считает отправленные байты
+type StatusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// NewStatusWriter оборачивает w
+func NewStatusWriter(w http.ResponseWriter) *StatusWriter {
+	return &StatusWriter{ResponseWriter: w}
+}
+
+// WriteHeader запоминает статус ответа
+func (w *StatusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write считает отправленные байты
+func (w *StatusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Status возвращает статус ответа, 200 если он не был записан явно
+func (w *StatusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Bytes возвращает число отправленных байт тела ответа
+func (w *StatusWriter) Bytes() int64 {
+	return w.bytes
+}
+
+// Unwrap дает http.ResponseController доступ к исходному ResponseWriter
+func (w *StatusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}